@@ -0,0 +1,12 @@
+// Package extensus holds the templates, migrations, message catalogs and
+// static files that are embedded into the master binary.
+package extensus
+
+import "embed"
+
+// Assets holds the templates, migrations, locales and public directories.
+// SCSS partials are named explicitly as files beginning with an underscore
+// are otherwise left out.
+//
+//go:embed templates migrations locales public public/scss/_*.scss
+var Assets embed.FS
@@ -3,6 +3,8 @@ package commands
 import (
 	"bufio"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,15 +14,30 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/i18n"
 	"github.com/octacian/extensus/master/models"
+	"github.com/octacian/migrate"
 	"github.com/octacian/shell"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // GetInput reads user input from the shell App's input stream (usually Stdin)
-// and returns it as a string. If any errors occur panic is called.
+// and returns it as a string. In the interactive shell input is read by the
+// line editor instead. If any errors occur panic is called.
 func GetInput(app *shell.App, prefix string) string {
+	if lineEditor != nil {
+		lineEditor.SetPrompt(prefix + " > ")
+		defer lineEditor.SetPrompt(shellPrompt)
+
+		text, err := lineEditor.Readline()
+		if err != nil {
+			log.Panic("GetInput: got error:\n", err)
+		}
+
+		return strings.TrimSpace(text)
+	}
+
 	reader := bufio.NewReader(app.Input)
 	app.Printf("%s > ", prefix)
 	text, err := reader.ReadString('\n')
@@ -34,6 +51,15 @@ func GetInput(app *shell.App, prefix string) string {
 // GetPassword does the same as GetInput but forces the use of Stdin to allow
 // preventing input from being echoed back to the terminal as it is entered.
 func GetPassword(app *shell.App, prefix string) string {
+	if lineEditor != nil {
+		text, err := lineEditor.ReadPassword(prefix + " > ")
+		if err != nil {
+			log.Panic("GetPassword: got error:\n", err)
+		}
+
+		return strings.TrimSpace(string(text))
+	}
+
 	app.Printf("%s > ", prefix)
 	text, err := terminal.ReadPassword(int(syscall.Stdin))
 	if err != nil {
@@ -46,87 +72,284 @@ func GetPassword(app *shell.App, prefix string) string {
 
 // getUserByIdentifier takes a user identifier as used by the user get and
 // change sub-commands and returns the user referenced or nil if none exist.
-// Error messages are printed to the App's output stream.
-func getUserByIdentifier(app *shell.App, identifier string) *models.User {
+// Deleted users are only returned if withDeleted is true. Error messages are
+// printed to the App's output stream.
+func getUserByIdentifier(app *shell.App, identifier string, withDeleted bool) *models.User {
 	var user *models.User
 	var userErr error
 
+	get := models.GetUser
+	if withDeleted {
+		get = models.GetAnyUser
+	}
+
+	if len(identifier) == 0 {
+		misuse(app, "Expected user email or #ID\n")
+		return nil
+	}
+
 	if identifier[0] == '#' {
 		if len(identifier) < 2 {
-			app.Println("Expected user ID")
+			fail(app, "Expected user ID\n")
 		} else {
 			target, err := strconv.Atoi(identifier[1:])
 			if err != nil {
 				if err, ok := err.(*strconv.NumError); !ok {
-					app.Printf("Got unexpected error:\n%s\n", err)
+					fail(app, "Got unexpected error:\n%s\n", err)
 				} else if err.Err == strconv.ErrSyntax {
-					app.Printf("Invalid ID number '%s'\n", err.Num)
+					fail(app, "Invalid ID number '%s'\n", err.Num)
 				} else if err.Err == strconv.ErrRange {
-					app.Printf("Number '%s' out of range\n", err.Num)
+					fail(app, "Number '%s' out of range\n", err.Num)
 				} else {
-					app.Printf("Got unexpected error with number '%s':\n%s\n", err.Num, err)
+					fail(app, "Got unexpected error with number '%s':\n%s\n", err.Num, err)
 				}
 
 				return nil
 			}
 
-			user, userErr = models.GetUser(target)
+			user, userErr = get(target)
 			if userErr != nil {
 				if _, ok := userErr.(*models.ErrNoEntry); ok {
-					app.Printf("No user with ID %d exists\n", target)
+					fail(app, "No user with ID %d exists\n", target)
 					return nil
 				}
 			}
 		}
 	} else {
-		user, userErr = models.GetUser(identifier)
+		user, userErr = get(identifier)
 		if userErr != nil {
 			if _, ok := userErr.(*models.ErrNoEntry); ok {
-				app.Printf("No user with email '%s' exists\n", identifier)
+				fail(app, "No user with email '%s' exists\n", identifier)
 				return nil
 			}
 		}
 	}
 
 	if userErr != nil {
-		app.Printf("Got unexpected error:\n%s\n", userErr)
+		fail(app, "Got unexpected error:\n%s\n", userErr)
 		return nil
 	}
 
 	return user
 }
 
-// checkUserError takes an error and checks if it is a model.ErrInvalid,
-// printing the appropriate message to the App's output.
+// userRecord returns a Record describing a user.
+func userRecord(user *models.User) Record {
+	return Record{
+		{"id", "ID", user.ID},
+		{"name", "Name", user.Name},
+		{"email", "Email", user.Email},
+		{"created", "Created", user.Created},
+		{"modified", "Modified", user.Modified},
+		{"deleted", "Deleted", user.Deleted},
+	}
+}
+
+// checkUserError takes an error and checks if it is a model.ErrInvalid or a
+// model.ErrConflict, printing the appropriate message to the App's output in
+// the locale of the environment.
 func checkUserError(app *shell.App, err error) {
-	if invalid, ok := err.(*models.ErrInvalid); ok {
-		switch which := invalid.Which; which {
-		case "name", "email":
-			app.Printf("Invalid %s '%s'\n", which, invalid.Value)
-		case "password":
-			app.Println("Invalid password (must be at least 8 characters)")
-			app.Printf("Password = '%s'\n", invalid.Value)
-		default:
-			app.Printf("Got unexpected invalid field %s with value '%s'\n", invalid.Which, invalid.Value)
+	locale := shellLocale()
+	if models.IsErrConflict(err) {
+		fail(app, "%s\n", locale.T("shell.conflict"))
+		fail(app, "%s\n", locale.T("shell.conflictRetry"))
+	} else if invalid, ok := err.(*models.ErrInvalid); ok {
+		if invalid.Value != "" && invalid.Code == "" {
+			fail(app, "%s: '%s'\n", invalid.Localize(locale), invalid.Value)
+		} else {
+			fail(app, "%s\n", invalid.Localize(locale))
 		}
 	} else {
-		app.Printf("Got unexpected error:\n%s\n", err)
+		fail(app, "%s\n", locale.T("shell.unexpected", err))
+	}
+}
+
+// shellLocale returns the locale matching the environment the shell is run
+// in, as given by LC_ALL, LC_MESSAGES or LANG.
+func shellLocale() *i18n.Locale {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return i18n.FromEnvironment(value)
+		}
+	}
+
+	return i18n.Default()
+}
+
+// describeInvalid returns a short description of why a field is invalid.
+func describeInvalid(invalid *models.ErrInvalid) string {
+	if invalid.Reason != "" {
+		return fmt.Sprintf("Invalid %s (%s)", invalid.Which, invalid.Reason)
+	} else if invalid.Value == "" {
+		return fmt.Sprintf("Missing %s", invalid.Which)
 	}
+
+	return fmt.Sprintf("Invalid %s '%s'", invalid.Which, invalid.Value)
+}
+
+// transferFormat returns the format users are imported from or exported to.
+// If no format is given it is guessed from the extension of the path. If the
+// format is unknown an error is returned.
+func transferFormat(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	for _, known := range models.UserTransferFormats {
+		if format == known {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown format '%s', use -format to choose one of %s", format,
+		strings.Join(models.UserTransferFormats, ", "))
+}
+
+// checkImportError takes an error returned while importing users and prints
+// the reason every rejected record out of the total could not be imported.
+func checkImportError(app *shell.App, err error, total int) {
+	importErr, ok := err.(*models.ErrImport)
+	if !ok {
+		fail(app, "Got unexpected error:\n%s\n", err)
+		return
+	}
+
+	rows := make([]int, 0, len(importErr.Rows))
+	for row := range importErr.Rows {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+
+	for _, row := range rows {
+		if invalid, ok := importErr.Rows[row].(*models.ErrInvalid); ok {
+			fail(app, "Record %d: %s\n", row, describeInvalid(invalid))
+		} else {
+			fail(app, "Record %d: %s\n", row, importErr.Rows[row])
+		}
+	}
+	fail(app, "%d of %d records are invalid, no users were imported\n", len(rows), total)
+}
+
+// sendInvite delivers an invitation and returns true if it was sent. Failures
+// are printed to the App's output stream, as is success in text output.
+func sendInvite(app *shell.App, invite *models.Invite) bool {
+	if err := invite.Send(); err != nil {
+		fail(app, "Failed to send invitation to '%s':\n%s\n", invite.Email, err)
+		fail(app, "Run user invite %s to send a new invitation\n", invite.Email)
+		return false
+	}
+
+	if textOutput() {
+		app.Printf("Sent invitation to '%s', it expires %s\n", invite.Email, invite.Expires.Format(time.RFC1123))
+	}
+	return true
 }
 
 // handleSaveUser takes a user object and attempts to save it, printing the
-// appropriate error message depending on the type of error returned.
+// appropriate error message depending on the type of error returned. Outside of
+// text output the saved user is printed.
 func handleSaveUser(app *shell.App, user *models.User) {
 	if err := user.Save(); err != nil {
 		checkUserError(app, err)
+	} else {
+		renderResult(app, userRecord(user), "")
 	}
 }
 
+// migrationResult returns a Record describing the version of the database
+// after migrating and whether any migrations were applied.
+func migrationResult(migrated bool) Record {
+	return Record{
+		{"version", "Version", core.GetMigrate().Version()},
+		{"migrated", "Migrated", migrated},
+	}
+}
+
+// FormatMigrationPlan returns a human-readable description of the steps that
+// would be taken to migrate the database, including the SQL of each step.
+func FormatMigrationPlan(steps []core.MigrationStep) string {
+	if len(steps) == 0 {
+		return "No migrations to apply\n"
+	}
+
+	var builder strings.Builder
+	for _, step := range steps {
+		direction := "up to"
+		if !step.Up {
+			direction = "down from"
+		}
+
+		fmt.Fprintf(&builder, "-- Migrate %s version %d\n%s\n\n", direction, step.Version, step.SQL)
+	}
+
+	return builder.String()
+}
+
+// migrationStatusRecords returns a Record describing the status of each
+// migration.
+func migrationStatusRecords(statuses []core.MigrationStatus) []Record {
+	records := make([]Record, len(statuses))
+	for i, status := range statuses {
+		state := "pending"
+		if status.Modified {
+			state = "modified"
+		} else if status.Applied {
+			state = "applied"
+		}
+
+		records[i] = Record{
+			{"version", "Version", status.Version},
+			{"status", "Status", state},
+			{"applied", "Applied", status.AppliedAt},
+			{"files", "Files", status.Files},
+		}
+	}
+
+	return records
+}
+
+// checkMigrations validates the migrations directory, printing any problems
+// found to the App's output. Returns true if no problems were found.
+func checkMigrations(app *shell.App) bool {
+	problems, err := core.ValidateMigrations()
+	if err != nil {
+		fail(app, "Got unexpected error:\n%s\n", err)
+		return false
+	}
+
+	for _, problem := range problems {
+		fail(app, "Invalid migration: %s\n", problem)
+	}
+
+	return len(problems) == 0
+}
+
 // Register adds all commands to the shell instance.
 func Register() {
-	app := core.GetShell()
+	add(shell.Command{
+		Name:     "output",
+		Synopsis: "show or change the output format",
+		Usage: `${name} [text|json|yaml|csv]:
+
+Show or change the format commands print information in. The format can also be
+set with the -output flag when starting the program.`,
+		Main: func(ctx *shell.Context) shell.ExitStatus {
+			switch ctx.FlagSet().NArg() {
+			case 0:
+				renderResult(ctx.App(), Record{{"format", "Format", outputFormat}}, "Output format is %s\n", outputFormat)
+			case 1:
+				if err := SetOutput(ctx.FlagSet().Arg(0)); err != nil {
+					fail(ctx.App(), "%s\n", err)
+				}
+			default:
+				return shell.ExitUsage
+			}
 
-	app.AddCommand(shell.Command{
+			return shell.ExitCmd
+		},
+	})
+
+	add(shell.Command{
 		Name:     "migrate",
 		Synopsis: "manage database version and migrations",
 		Usage: `${name} <sub-command>:
@@ -142,7 +365,9 @@ See ${name} help for information on sub-commands.`,
 				Synopsis: "get current database migration version",
 				Usage:    "${fullName}",
 				Main: func(ctx *shell.Context) shell.ExitStatus {
-					ctx.App().Printf("Current migrate version is %d.\n", core.GetMigrate().Version())
+					version := core.GetMigrate().Version()
+					renderResult(ctx.App(), Record{{"version", "Version", version}}, "Current migrate version is %d.\n",
+						version)
 					return shell.ExitCmd
 				},
 			},
@@ -151,8 +376,14 @@ See ${name} help for information on sub-commands.`,
 				Synopsis: "migrate database to the latest available version",
 				Usage:    "${fullName}",
 				Main: func(ctx *shell.Context) shell.ExitStatus {
-					if err := core.GetMigrate().Latest(); err != nil {
-						ctx.App().Println(err)
+					if err := core.MigrateLatest(); err != nil {
+						if _, ok := err.(*migrate.ErrNoMigrations); ok {
+							renderResult(ctx.App(), migrationResult(false), "%s\n", err)
+						} else {
+							fail(ctx.App(), "%s\n", err)
+						}
+					} else {
+						renderResult(ctx.App(), migrationResult(true), "")
 					}
 					return shell.ExitCmd
 				},
@@ -163,18 +394,18 @@ See ${name} help for information on sub-commands.`,
 				Usage:    "${fullName} <version number>",
 				Main: func(ctx *shell.Context) shell.ExitStatus {
 					if ctx.FlagSet().NArg() != 1 {
-						ctx.App().Println(ctx.Command().Usage)
-						return shell.ExitCmd
+						return shell.ExitUsage
 					}
 
 					version, err := strconv.Atoi(ctx.FlagSet().Arg(0))
 					if err != nil {
-						ctx.App().Println(ctx.Command().Usage)
-						return shell.ExitCmd
+						return shell.ExitUsage
 					}
 
-					if err := core.GetMigrate().Goto(version); err != nil {
-						ctx.App().Println(err)
+					if err := core.MigrateTo(version); err != nil {
+						fail(ctx.App(), "%s\n", err)
+					} else {
+						renderResult(ctx.App(), migrationResult(true), "")
 					}
 
 					return shell.ExitCmd
@@ -185,14 +416,213 @@ See ${name} help for information on sub-commands.`,
 				Synopsis: "list all available database migration versions",
 				Usage:    "${fullName}",
 				Main: func(ctx *shell.Context) shell.ExitStatus {
-					ctx.App().Println(core.GetMigrate().List())
+					migrations, err := core.ReadMigrations()
+					if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						return shell.ExitCmd
+					}
+
+					records := make([]Record, len(migrations))
+					for i, migration := range migrations {
+						records[i] = Record{
+							{"version", "Version", migration.Version},
+							{"files", "Files", migration.Files},
+							{"checksum", "Checksum", migration.Checksum},
+						}
+					}
+
+					renderList(ctx.App(), records)
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "status",
+				Synopsis: "show applied and pending database migrations",
+				Usage: `${fullName}:
+
+List every migration with whether it has been applied and when. Applied
+migrations whose files were edited afterwards are marked as modified.`,
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					statuses, err := core.GetMigrationStatus()
+					if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						return shell.ExitCmd
+					}
+
+					renderTable(ctx.App(), migrationStatusRecords(statuses))
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "plan",
+				Synopsis: "show the SQL that migrating would run without applying it",
+				Usage:    "${fullName} [version number]",
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					var target int
+					var err error
+					switch ctx.FlagSet().NArg() {
+					case 0:
+						target, err = core.LatestMigration()
+					case 1:
+						target, err = strconv.Atoi(ctx.FlagSet().Arg(0))
+						if err != nil {
+							return shell.ExitUsage
+						}
+					default:
+						return shell.ExitUsage
+					}
+
+					if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						return shell.ExitCmd
+					}
+
+					steps, err := core.PlanMigration(target)
+					if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+					} else if textOutput() {
+						ctx.App().Print(FormatMigrationPlan(steps))
+					} else {
+						records := make([]Record, len(steps))
+						for i, step := range steps {
+							direction := "up"
+							if !step.Up {
+								direction = "down"
+							}
+
+							records[i] = Record{
+								{"version", "Version", step.Version},
+								{"direction", "Direction", direction},
+								{"sql", "SQL", step.SQL},
+							}
+						}
+						renderList(ctx.App(), records)
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "new",
+				Synopsis: "create the next migration version from a template",
+				Usage: `${fullName} <name>:
+
+Create the directory for the next migration version containing <name>.sql with
+empty up and down sections. Existing migrations must be valid.`,
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() != 1 {
+						return shell.ExitUsage
+					}
+
+					if !checkMigrations(ctx.App()) {
+						fail(ctx.App(), "Fix the migrations above before creating a new one\n")
+						return shell.ExitCmd
+					}
+
+					if path, err := core.NewMigration(ctx.FlagSet().Arg(0)); err != nil {
+						fail(ctx.App(), "%s\n", err)
+					} else {
+						renderResult(ctx.App(), Record{{"path", "Path", path}}, "Created %s\n", path)
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "verify",
+				Synopsis: "prove that all migrations can be applied and reverted",
+				Usage: `${fullName}:
+
+Apply every migration up, down and up again against the scratch database set in
+the configuration file.`,
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if !checkMigrations(ctx.App()) {
+						return shell.ExitCmd
+					}
+
+					if err := core.VerifyMigrations(); err != nil {
+						fail(ctx.App(), "%s\n", err)
+					} else {
+						renderResult(ctx.App(), Record{{"verified", "Verified", true}},
+							"All migrations can be applied and reverted\n")
+					}
+
 					return shell.ExitCmd
 				},
 			},
 		},
 	})
 
-	app.AddCommand(shell.Command{
+	add(shell.Command{
+		Name:     "db",
+		Synopsis: "back up and restore the database",
+		Usage: `${name} <sub-command>:
+
+See ${name} help for information on sub-commands.`,
+		Main: func(ctx *shell.Context) shell.ExitStatus {
+			ctx.App().Println(ctx.Command().Usage)
+			return shell.ExitCmd
+		},
+		SubCommands: []shell.Command{
+			{
+				Name:     "backup",
+				Synopsis: "write a compressed backup of all tables",
+				Usage: `${fullName} [path]:
+
+Write a backup of every table created by migrations along with the current
+schema version. The migration log is not included. If no path is given, the
+backup is written to the configured backup directory.`,
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() > 1 {
+						return shell.ExitUsage
+					}
+
+					if path, err := core.CreateBackupFile(ctx.FlagSet().Arg(0)); err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+					} else {
+						renderResult(ctx.App(), Record{{"path", "Path", path}}, "Backed up database to %s\n", path)
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "restore",
+				Synopsis: "replace all tables with the contents of a backup",
+				Usage: `${fullName} ${shortFlags} <path>:
+
+Replace the contents of every table in a backup. The database must be at the
+schema version the backup was taken at unless -migrate is given. The migration
+log is left as it is.
+
+${flags}`,
+				SetFlags: func(ctx *shell.Context) {
+					ctx.Set("flagMigrate", ctx.FlagSet().Bool("migrate", false,
+						"Migrate the database to the schema version of the backup first."))
+				},
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() != 1 {
+						return shell.ExitUsage
+					}
+
+					err := core.RestoreBackupFile(ctx.FlagSet().Arg(0), *ctx.MustGet("flagMigrate").(*bool))
+					if versionErr, ok := err.(*core.ErrBackupVersion); ok && versionErr.Backup <= versionErr.Latest {
+						fail(ctx.App(), "%s\n", err)
+						fail(ctx.App(), "Run with -migrate to migrate to version %d first\n", versionErr.Backup)
+					} else if err != nil {
+						fail(ctx.App(), "%s\n", err)
+					} else {
+						renderResult(ctx.App(), Record{{"path", "Path", ctx.FlagSet().Arg(0)}},
+							"Restored database from %s\n", ctx.FlagSet().Arg(0))
+					}
+
+					return shell.ExitCmd
+				},
+			},
+		},
+	})
+
+	add(shell.Command{
 		Name:     "bench-cost",
 		Synopsis: "benchmarks how long it takes to generate hashes",
 		Usage: `${name} ${shortFlags}:
@@ -211,24 +641,38 @@ ${flags}`,
 			ctx.Set("flagTest", flags.String("test", "!test?9@_*", "Plaintext password to test."))
 		},
 		Main: func(ctx *shell.Context) shell.ExitStatus {
+			records := []Record{}
 			for cost := *ctx.MustGet("flagStart").(*uint); cost <= *ctx.MustGet("flagEnd").(*uint); cost++ {
-				ctx.App().Printf("Cost factor: %d\t\t...", cost)
+				if textOutput() {
+					ctx.App().Printf("Cost factor: %d\t\t...", cost)
+				}
 
 				start := time.Now()
 				_, err := bcrypt.GenerateFromPassword([]byte(*ctx.MustGet("flagTest").(*string)), int(cost))
 				if err != nil {
-					ctx.App().Printf("Got error while generating hash for cost of %d:\n%s\n", cost, err)
+					fail(ctx.App(), "Got error while generating hash for cost of %d:\n%s\n", cost, err)
 				}
 				end := time.Now()
 
-				ctx.App().Printf("\rCost factor: %d\t\t%s\n", cost, end.Sub(start))
+				if textOutput() {
+					ctx.App().Printf("\rCost factor: %d\t\t%s\n", cost, end.Sub(start))
+				} else {
+					records = append(records, Record{
+						{"cost", "Cost", cost},
+						{"milliseconds", "Milliseconds", end.Sub(start).Seconds() * 1000},
+					})
+				}
+			}
+
+			if !textOutput() {
+				renderList(ctx.App(), records)
 			}
 
 			return shell.ExitCmd
 		},
 	})
 
-	app.AddCommand(shell.Command{
+	add(shell.Command{
 		Name:     "user",
 		Synopsis: "list and manipulate user accounts",
 		Usage: `${name} <sub-command>:
@@ -241,24 +685,37 @@ ${flags}`,
 			{
 				Name:     "list",
 				Synopsis: "list user accounts",
-				Usage:    "${fullName}",
+				Usage: `${fullName} ${shortFlags}
+
+${flags}`,
+				SetFlags: func(ctx *shell.Context) {
+					ctx.Set("flagDeleted", ctx.FlagSet().Bool("deleted", false, "List deleted users instead."))
+				},
 				Main: func(ctx *shell.Context) shell.ExitStatus {
-					users, err := models.ListUser()
+					list := models.ListUser
+					if *ctx.MustGet("flagDeleted").(*bool) {
+						list = models.ListDeletedUser
+					}
+
+					users, err := list()
 					if err != nil {
-						if _, ok := err.(*models.ErrEmpty); ok {
+						if _, ok := err.(*models.ErrEmpty); !ok {
+							fail(ctx.App(), "%s\n", err)
+						} else if textOutput() {
 							ctx.App().Println("No users exist")
 						} else {
-							ctx.App().Println(err)
+							renderList(ctx.App(), []Record{})
 						}
 					} else {
 						sort.Slice(users, func(i, j int) bool {
 							return users[i].Name < users[j].Name
 						})
 
-						for _, user := range users {
-							ctx.App().Printf("ID:\t\t%d\nName:\t\t%s\nEmail:\t\t%s\nCreated:\t%s\nModified:\t%s\n\n",
-								user.ID, user.Name, user.Email, user.Created, user.Modified)
+						records := make([]Record, len(users))
+						for i := range users {
+							records[i] = userRecord(&users[i])
 						}
+						renderList(ctx.App(), records)
 					}
 
 					return shell.ExitCmd
@@ -273,9 +730,8 @@ ${flags}`,
 						return shell.ExitUsage
 					}
 
-					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0)); user != nil {
-						ctx.App().Printf("ID:\t\t%d\nName:\t\t%s\nEmail:\t\t%s\nCreated:\t%s\nModified:\t%s\n",
-							user.ID, user.Name, user.Email, user.Created, user.Modified)
+					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0), true); user != nil {
+						renderRecord(ctx.App(), userRecord(user))
 					}
 
 					return shell.ExitCmd
@@ -284,15 +740,34 @@ ${flags}`,
 			{
 				Name:     "add",
 				Synopsis: "create a new user account",
-				Usage:    "${fullName}",
+				Usage: `${fullName} ${shortFlags}:
+
+Create a new user account. Any values not given as flags are prompted for when
+running interactively.
+
+${flags}`,
+				SetFlags: func(ctx *shell.Context) {
+					ctx.FlagSet().String("name", "", "Full name of the user.")
+					ctx.FlagSet().String("email", "", "Email address of the user.")
+					setPasswordFlags(ctx)
+				},
 				Main: func(ctx *shell.Context) shell.ExitStatus {
 					if ctx.FlagSet().NArg() > 0 {
 						return shell.ExitUsage
 					}
 
-					name := GetInput(ctx.App(), "Full Name")
-					email := GetInput(ctx.App(), "Email")
-					password := GetPassword(ctx.App(), "Password")
+					name, ok := resolveInput(ctx, "name", "Full Name", false)
+					if !ok {
+						return shell.ExitCmd
+					}
+					email, ok := resolveInput(ctx, "email", "Email", false)
+					if !ok {
+						return shell.ExitCmd
+					}
+					password, ok := resolvePassword(ctx, "Password", false)
+					if !ok {
+						return shell.ExitCmd
+					}
 
 					user, err := models.NewUser(name, email, password)
 					if err != nil {
@@ -307,17 +782,38 @@ ${flags}`,
 			{
 				Name:     "change",
 				Synopsis: "change an existing user",
-				Usage:    "${fullName} #<user ID>|<user email>",
+				Usage: `${fullName} ${shortFlags} #<user ID>|<user email>:
+
+Change an existing user. Values not given as flags are prompted for when running
+interactively and are otherwise left unchanged.
+
+${flags}`,
+				SetFlags: func(ctx *shell.Context) {
+					ctx.FlagSet().String("name", "", "New full name of the user.")
+					ctx.FlagSet().String("email", "", "New email address of the user.")
+					setPasswordFlags(ctx)
+				},
 				Main: func(ctx *shell.Context) shell.ExitStatus {
 					if ctx.FlagSet().NArg() != 1 {
 						return shell.ExitUsage
 					}
 
-					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0)); user != nil {
-						ctx.App().Println("Leave input blank to keep values in brackets.")
-						name := GetInput(ctx.App(), fmt.Sprintf("Full Name [%s]", user.Name))
-						email := GetInput(ctx.App(), fmt.Sprintf("Email [%s]", user.Email))
-						password := GetPassword(ctx.App(), "Password [*]")
+					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0), false); user != nil {
+						if interactive {
+							ctx.App().Println("Leave input blank to keep values in brackets.")
+						}
+						name, ok := resolveInput(ctx, "name", fmt.Sprintf("Full Name [%s]", user.Name), true)
+						if !ok {
+							return shell.ExitCmd
+						}
+						email, ok := resolveInput(ctx, "email", fmt.Sprintf("Email [%s]", user.Email), true)
+						if !ok {
+							return shell.ExitCmd
+						}
+						password, ok := resolvePassword(ctx, "Password [*]", true)
+						if !ok {
+							return shell.ExitCmd
+						}
 
 						if name != "" {
 							user.Name = name
@@ -340,17 +836,238 @@ ${flags}`,
 			},
 			{
 				Name:     "delete",
-				Synopsis: "remove a user",
+				Synopsis: "move a user to the trash",
 				Usage:    "${fullName} #<user ID>|<user email>",
 				Main: func(ctx *shell.Context) shell.ExitStatus {
 					if ctx.FlagSet().NArg() != 1 {
 						return shell.ExitUsage
 					}
 
-					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0)); user != nil {
+					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0), false); user != nil {
 						if err := user.Delete(); err != nil {
-							ctx.App().Printf("Got unexpected error:\n%s\n", err)
+							fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						}
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "restore",
+				Synopsis: "restore a deleted user",
+				Usage:    "${fullName} #<user ID>|<user email>",
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() != 1 {
+						return shell.ExitUsage
+					}
+
+					if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0), true); user != nil {
+						if !user.IsDeleted() {
+							fail(ctx.App(), "User '%s' is not deleted\n", user.Email)
+						} else if err := user.Restore(); err != nil {
+							fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						}
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "purge",
+				Synopsis: "permanently remove deleted users",
+				Usage: `${fullName} [#<user ID>|<user email>]:
+
+Permanently remove a deleted user. If no user is given, all users deleted for
+longer than the configured purge period are removed.`,
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					switch ctx.FlagSet().NArg() {
+					case 0:
+						count, err := models.PurgeExpiredUsers()
+						if err != nil {
+							fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						} else {
+							renderResult(ctx.App(), Record{{"purged", "Purged", count}}, "Purged %d users\n", count)
 						}
+					case 1:
+						if user := getUserByIdentifier(ctx.App(), ctx.FlagSet().Arg(0), true); user != nil {
+							if !user.IsDeleted() {
+								fail(ctx.App(), "User '%s' must be deleted before it can be purged\n", user.Email)
+							} else if err := user.Purge(); err != nil {
+								fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+							} else {
+								renderResult(ctx.App(), Record{{"purged", "Purged", 1}}, "")
+							}
+						}
+					default:
+						return shell.ExitUsage
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "invite",
+				Synopsis: "invite someone to create their own account",
+				Usage: `${fullName} <email>:
+
+Send an invitation link to an email address, allowing its owner to choose their
+own name and password. Earlier invitations to the same address stop working.`,
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() != 1 {
+						return shell.ExitUsage
+					}
+
+					invite, err := models.NewInvite(ctx.FlagSet().Arg(0), nil)
+					if invalid, ok := err.(*models.ErrInvalid); ok {
+						fail(ctx.App(), "%s\n", describeInvalid(invalid))
+					} else if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+					} else if err := invite.Save(); err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+					} else {
+						sent := sendInvite(ctx.App(), invite)
+						renderResult(ctx.App(), Record{
+							{"email", "Email", invite.Email},
+							{"expires", "Expires", invite.Expires},
+							{"sent", "Sent", sent},
+						}, "")
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "import",
+				Synopsis: "create users from a CSV or JSON file",
+				Usage: `${fullName} ${shortFlags} <path>:
+
+Create a user for every record in a CSV or JSON file, or in standard input if the
+path is -. Records have a name, email, roles, and either an already hashed
+password or invite set to true to send an invitation instead. Invited users
+choose their own name, so their records must leave it empty. If any record is
+invalid no users are created.
+
+${flags}`,
+				SetFlags: func(ctx *shell.Context) {
+					ctx.Set("flagFormat", ctx.FlagSet().String("format", "",
+						"Format of the file, guessed from its extension if not given."))
+					ctx.Set("flagDryRun", ctx.FlagSet().Bool("dry-run", false,
+						"Check every record without creating any users."))
+				},
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() != 1 {
+						return shell.ExitUsage
+					}
+
+					path := ctx.FlagSet().Arg(0)
+					format, err := transferFormat(*ctx.MustGet("flagFormat").(*string), path)
+					if err != nil {
+						fail(ctx.App(), "%s\n", err)
+						return shell.ExitCmd
+					}
+
+					file := os.Stdin
+					if path != "-" {
+						if file, err = os.Open(path); err != nil {
+							fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+							return shell.ExitCmd
+						}
+						defer file.Close()
+					}
+
+					records, err := models.ReadUserRecords(file, format)
+					if err != nil {
+						fail(ctx.App(), "Failed to read %s:\n%s\n", path, err)
+						return shell.ExitCmd
+					}
+
+					if *ctx.MustGet("flagDryRun").(*bool) {
+						if _, err := models.ValidateUserRecords(records); err != nil {
+							checkImportError(ctx.App(), err, len(records))
+						} else {
+							renderResult(ctx.App(), Record{{"valid", "Valid", len(records)}},
+								"All %d records can be imported\n", len(records))
+						}
+					} else if result, err := models.ImportUsers(records); err != nil {
+						checkImportError(ctx.App(), err, len(records))
+					} else {
+						if textOutput() {
+							ctx.App().Printf("Imported %d users and %d invitations\n", len(result.Users),
+								len(result.Invites))
+						}
+
+						sent := []string{}
+						for _, invite := range result.Invites {
+							if sendInvite(ctx.App(), invite) {
+								sent = append(sent, invite.Email)
+							}
+						}
+						renderResult(ctx.App(), Record{
+							{"users", "Users", len(result.Users)},
+							{"invitations", "Invitations", len(result.Invites)},
+							{"sent", "Sent", sent},
+						}, "")
+					}
+
+					return shell.ExitCmd
+				},
+			},
+			{
+				Name:     "export",
+				Synopsis: "write all users to a CSV or JSON file",
+				Usage: `${fullName} ${shortFlags} [path]:
+
+Write every user that has not been deleted to a file in the format read by user
+import, including hashed passwords. If no path is given the users are printed.
+
+${flags}`,
+				SetFlags: func(ctx *shell.Context) {
+					ctx.Set("flagFormat", ctx.FlagSet().String("format", "",
+						"Format of the file, guessed from its extension if not given."))
+				},
+				Main: func(ctx *shell.Context) shell.ExitStatus {
+					if ctx.FlagSet().NArg() > 1 {
+						return shell.ExitUsage
+					}
+
+					path, format := ctx.FlagSet().Arg(0), *ctx.MustGet("flagFormat").(*string)
+					if path == "" && format == "" {
+						format = "csv"
+					}
+					format, err := transferFormat(format, path)
+					if err != nil {
+						fail(ctx.App(), "%s\n", err)
+						return shell.ExitCmd
+					}
+
+					records, err := models.ExportUsers()
+					if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						return shell.ExitCmd
+					}
+
+					if path == "" {
+						var builder strings.Builder
+						if err := models.WriteUserRecords(&builder, format, records); err != nil {
+							fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						} else {
+							ctx.App().Print(builder.String())
+						}
+						return shell.ExitCmd
+					}
+
+					file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+					if err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+						return shell.ExitCmd
+					}
+					defer file.Close()
+
+					if err := models.WriteUserRecords(file, format, records); err != nil {
+						fail(ctx.App(), "Got unexpected error:\n%s\n", err)
+					} else {
+						renderResult(ctx.App(), Record{{"path", "Path", path}, {"users", "Users", len(records)}},
+							"Exported %d users to %s\n", len(records), path)
 					}
 
 					return shell.ExitCmd
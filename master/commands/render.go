@@ -0,0 +1,276 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/octacian/shell"
+	"gopkg.in/yaml.v2"
+)
+
+// OutputFormats lists the formats commands can render records in.
+var OutputFormats = []string{"text", "json", "yaml", "csv"}
+
+// outputFormat is the format records are currently rendered in.
+var outputFormat = "text"
+
+// Field is a single value within a Record. The key is a stable name used by
+// machine-readable formats while the label is shown in text output.
+type Field struct {
+	Key   string
+	Label string
+	Value interface{}
+}
+
+// Record is an ordered list of fields describing a single item.
+type Record []Field
+
+// SetOutput changes the format commands render records in. If the format is
+// not one of OutputFormats an error is returned.
+func SetOutput(format string) error {
+	for _, known := range OutputFormats {
+		if format == known {
+			outputFormat = format
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output format '%s', expected one of %s", format, strings.Join(OutputFormats, ", "))
+}
+
+// textOutput returns true if records are rendered as human-readable text.
+func textOutput() bool {
+	return outputFormat == "text"
+}
+
+// normalize converts a field value into a form that is rendered the same way
+// by every format. Times are formatted as RFC 3339 in UTC and nil pointers
+// become nil.
+func normalize(value interface{}) interface{} {
+	switch value := value.(type) {
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		if value == nil {
+			return nil
+		}
+		return value.UTC().Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return value
+	}
+}
+
+// toString converts a normalized value into a string for text and CSV output.
+func toString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(value, ";")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// marshalJSON encodes a record as a JSON object, preserving the field order.
+func (record Record) marshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, field := range record {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(normalize(field.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// mapSlice converts a record into an ordered YAML mapping.
+func (record Record) mapSlice() yaml.MapSlice {
+	slice := make(yaml.MapSlice, len(record))
+	for i, field := range record {
+		slice[i] = yaml.MapItem{Key: field.Key, Value: normalize(field.Value)}
+	}
+
+	return slice
+}
+
+// formatText formats records as aligned label and value pairs separated by
+// blank lines. Fields with nil values are omitted.
+func formatText(records []Record) string {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 8, 1, '\t', 0)
+	for i, record := range records {
+		if i > 0 {
+			fmt.Fprintln(writer)
+		}
+
+		for _, field := range record {
+			if value := normalize(field.Value); value != nil {
+				fmt.Fprintf(writer, "%s:\t%s\n", field.Label, toString(value))
+			}
+		}
+	}
+	writer.Flush()
+
+	return builder.String()
+}
+
+// formatTable formats records as a table with a row for each record beneath a
+// row of labels. Fields with nil values are left blank.
+func formatTable(records []Record) string {
+	if len(records) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 8, 2, ' ', 0)
+	labels := make([]string, len(records[0]))
+	for i, field := range records[0] {
+		labels[i] = field.Label
+	}
+	fmt.Fprintln(writer, strings.Join(labels, "\t"))
+
+	for _, record := range records {
+		values := make([]string, len(record))
+		for i, field := range record {
+			values[i] = toString(normalize(field.Value))
+		}
+		fmt.Fprintln(writer, strings.Join(values, "\t"))
+	}
+	writer.Flush()
+
+	return builder.String()
+}
+
+// formatCSV formats records as CSV with a header row naming each field.
+func formatCSV(records []Record) (string, error) {
+	var builder strings.Builder
+	writer := csv.NewWriter(&builder)
+	for i, record := range records {
+		if i == 0 {
+			header := make([]string, len(record))
+			for j, field := range record {
+				header[j] = field.Key
+			}
+			if err := writer.Write(header); err != nil {
+				return "", err
+			}
+		}
+
+		row := make([]string, len(record))
+		for j, field := range record {
+			row[j] = toString(normalize(field.Value))
+		}
+		if err := writer.Write(row); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+
+	return builder.String(), writer.Error()
+}
+
+// format formats records in the current output format. If single is true the
+// records are expected to hold exactly one record, which is rendered on its
+// own rather than as a list in the JSON and YAML formats.
+func format(records []Record, single bool) (string, error) {
+	switch outputFormat {
+	case "json":
+		items := make([]json.RawMessage, len(records))
+		for i, record := range records {
+			data, err := record.marshalJSON()
+			if err != nil {
+				return "", err
+			}
+			items[i] = data
+		}
+
+		var value interface{} = items
+		if single {
+			value = items[0]
+		}
+
+		data, err := json.MarshalIndent(value, "", "  ")
+		return string(data) + "\n", err
+	case "yaml":
+		items := make([]yaml.MapSlice, len(records))
+		for i, record := range records {
+			items[i] = record.mapSlice()
+		}
+
+		var value interface{} = items
+		if single {
+			value = items[0]
+		}
+
+		data, err := yaml.Marshal(value)
+		return string(data), err
+	case "csv":
+		return formatCSV(records)
+	default:
+		return formatText(records), nil
+	}
+}
+
+// renderList prints a list of records to the App's output stream in the
+// current output format.
+func renderList(app *shell.App, records []Record) {
+	if output, err := format(records, false); err != nil {
+		fail(app, "Got error while formatting output:\n%s\n", err)
+	} else {
+		app.Print(output)
+	}
+}
+
+// renderRecord prints a single record to the App's output stream in the
+// current output format.
+func renderRecord(app *shell.App, record Record) {
+	if output, err := format([]Record{record}, true); err != nil {
+		fail(app, "Got error while formatting output:\n%s\n", err)
+	} else {
+		app.Print(output)
+	}
+}
+
+// renderTable prints a list of records to the App's output stream as a table
+// in text output or in the current machine-readable format otherwise.
+func renderTable(app *shell.App, records []Record) {
+	if textOutput() {
+		app.Print(formatTable(records))
+	} else {
+		renderList(app, records)
+	}
+}
+
+// renderResult prints the outcome of a command to the App's output stream.
+// Text output prints the message, if any, while other formats print the record
+// so that the output can still be parsed.
+func renderResult(app *shell.App, record Record, message string, args ...interface{}) {
+	if !textOutput() {
+		renderRecord(app, record)
+	} else if message != "" {
+		app.Printf(message, args...)
+	}
+}
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/models"
+)
+
+// TestFormatUserList ensures that the records printed by user list are
+// rendered in every output format.
+func TestFormatUserList(t *testing.T) {
+	created := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	records := []Record{
+		userRecord(&models.User{ID: 1, Name: "John Doe", Email: "john@doe.me", Created: created, Modified: created}),
+		userRecord(&models.User{ID: 2, Name: "Jane Doe", Email: "jane@doe.me", Created: created, Modified: created,
+			Deleted: &created}),
+	}
+
+	tests := map[string]string{
+		// Labels are padded with tabs to align the values.
+		"text": "ID:\t\t1\nName:\t\tJohn Doe\nEmail:\t\tjohn@doe.me\nCreated:\t2019-03-04T05:06:07Z\n" +
+			"Modified:\t2019-03-04T05:06:07Z\n\nID:\t\t2\nName:\t\tJane Doe\nEmail:\t\tjane@doe.me\n" +
+			"Created:\t2019-03-04T05:06:07Z\nModified:\t2019-03-04T05:06:07Z\nDeleted:\t2019-03-04T05:06:07Z\n",
+		"json": `[
+  {
+    "id": 1,
+    "name": "John Doe",
+    "email": "john@doe.me",
+    "created": "2019-03-04T05:06:07Z",
+    "modified": "2019-03-04T05:06:07Z",
+    "deleted": null
+  },
+  {
+    "id": 2,
+    "name": "Jane Doe",
+    "email": "jane@doe.me",
+    "created": "2019-03-04T05:06:07Z",
+    "modified": "2019-03-04T05:06:07Z",
+    "deleted": "2019-03-04T05:06:07Z"
+  }
+]
+`,
+		"yaml": `- id: 1
+  name: John Doe
+  email: john@doe.me
+  created: "2019-03-04T05:06:07Z"
+  modified: "2019-03-04T05:06:07Z"
+  deleted: null
+- id: 2
+  name: Jane Doe
+  email: jane@doe.me
+  created: "2019-03-04T05:06:07Z"
+  modified: "2019-03-04T05:06:07Z"
+  deleted: "2019-03-04T05:06:07Z"
+`,
+		"csv": `id,name,email,created,modified,deleted
+1,John Doe,john@doe.me,2019-03-04T05:06:07Z,2019-03-04T05:06:07Z,
+2,Jane Doe,jane@doe.me,2019-03-04T05:06:07Z,2019-03-04T05:06:07Z,2019-03-04T05:06:07Z
+`,
+	}
+
+	defer SetOutput("text")
+	for name, expected := range tests {
+		if err := SetOutput(name); err != nil {
+			t.Fatal("SetOutput: got error:\n", err)
+		}
+
+		if got, err := format(records, false); err != nil {
+			t.Errorf("format(%s): got error:\n%s", name, err)
+		} else if got != expected {
+			t.Errorf("format(%s): got:\n%s\nexpected:\n%s", name, got, expected)
+		}
+	}
+}
+
+// TestFormatMigrationStatus ensures that the records printed by migrate status
+// are rendered as a table in text output and in every other output format.
+func TestFormatMigrationStatus(t *testing.T) {
+	applied := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	records := migrationStatusRecords([]core.MigrationStatus{
+		{Migration: core.Migration{Version: 1, Files: []string{"user.sql"}}, Applied: true, AppliedAt: &applied},
+		{Migration: core.Migration{Version: 2, Files: []string{"invite.sql", "history.sql"}}},
+	})
+
+	tests := map[string]string{
+		"text": `Version  Status   Applied               Files
+1        applied  2019-03-04T05:06:07Z  user.sql
+2        pending                        invite.sql;history.sql
+`,
+		"json": `[
+  {
+    "version": 1,
+    "status": "applied",
+    "applied": "2019-03-04T05:06:07Z",
+    "files": [
+      "user.sql"
+    ]
+  },
+  {
+    "version": 2,
+    "status": "pending",
+    "applied": null,
+    "files": [
+      "invite.sql",
+      "history.sql"
+    ]
+  }
+]
+`,
+		"yaml": `- version: 1
+  status: applied
+  applied: "2019-03-04T05:06:07Z"
+  files:
+  - user.sql
+- version: 2
+  status: pending
+  applied: null
+  files:
+  - invite.sql
+  - history.sql
+`,
+		"csv": `version,status,applied,files
+1,applied,2019-03-04T05:06:07Z,user.sql
+2,pending,,invite.sql;history.sql
+`,
+	}
+
+	defer SetOutput("text")
+	for name, expected := range tests {
+		if err := SetOutput(name); err != nil {
+			t.Fatal("SetOutput: got error:\n", err)
+		}
+
+		got, err := format(records, false)
+		if name == "text" {
+			got = formatTable(records)
+		}
+
+		if err != nil {
+			t.Errorf("format(%s): got error:\n%s", name, err)
+		} else if got != expected {
+			t.Errorf("format(%s): got:\n%s\nexpected:\n%s", name, got, expected)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"bufio"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/shell"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitSuccess = 0 // the command completed successfully
+	ExitFailure = 1 // the command reported an error
+	ExitUsage   = 2 // the command was used incorrectly or does not exist
+)
+
+var (
+	// interactive is true if commands may prompt for input.
+	interactive = true
+
+	// failed is true if a command has reported an error since it was reset.
+	failed bool
+
+	// misused is true if a command has returned shell.ExitUsage since it was
+	// reset.
+	misused bool
+
+	// registered holds every top-level command added by Register.
+	registered []shell.Command
+)
+
+// fail prints an error message to the App's output stream and records that
+// the current command failed.
+func fail(app *shell.App, format string, args ...interface{}) {
+	failed = true
+	app.Printf(format, args...)
+}
+
+// misuse prints a usage error to the App's output stream and records that the
+// current command was used incorrectly.
+func misuse(app *shell.App, format string, args ...interface{}) {
+	misused = true
+	app.Printf(format, args...)
+}
+
+// track wraps the Main function of a command and its sub-commands to record
+// when they are used incorrectly.
+func track(command shell.Command) shell.Command {
+	if main := command.Main; main != nil {
+		command.Main = func(ctx *shell.Context) shell.ExitStatus {
+			status := main(ctx)
+			if status == shell.ExitUsage {
+				misused = true
+			}
+			return status
+		}
+	}
+
+	subCommands := make([]shell.Command, len(command.SubCommands))
+	for i, subCommand := range command.SubCommands {
+		subCommands[i] = track(subCommand)
+	}
+	command.SubCommands = subCommands
+
+	return command
+}
+
+// add registers a command with the shell instance.
+func add(command shell.Command) {
+	registered = append(registered, command)
+	core.GetShell().AddCommand(track(command))
+}
+
+// quoteArgs joins command-line arguments into a single line of input for the
+// shell, quoting any arguments containing whitespace or quotes.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			quoted[i] = strconv.Quote(arg)
+		} else {
+			quoted[i] = arg
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// Run executes a single command non-interactively as if its arguments had
+// been entered in the shell and returns a process exit code. Commands never
+// prompt for input when run this way, so all input must be provided by flags.
+func Run(args []string) int {
+	if len(args) == 0 || findCommand(args[0]) == nil {
+		app := core.GetShell()
+		if len(args) > 0 {
+			app.Printf("Unknown command '%s'\n", args[0])
+		}
+		app.Println("Available commands:")
+		for _, command := range registered {
+			app.Printf("  %s\t%s\n", command.Name, command.Synopsis)
+		}
+		return ExitUsage
+	}
+
+	interactive = false
+	failed, misused = false, false
+	execute(quoteArgs(args))
+
+	return exitCode()
+}
+
+// flagGiven returns true if a flag was set on the command-line.
+func flagGiven(flags *flag.FlagSet, name string) bool {
+	given := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+
+	return given
+}
+
+// resolveInput returns the value of a string flag if it was given. Otherwise
+// the user is prompted for the value if commands are interactive. If they are
+// not, an empty string is returned if the value is optional or an error is
+// printed and ok is false.
+func resolveInput(ctx *shell.Context, name, prompt string, optional bool) (value string, ok bool) {
+	if flagGiven(ctx.FlagSet(), name) {
+		return strings.TrimSpace(ctx.FlagSet().Lookup(name).Value.String()), true
+	}
+
+	if interactive {
+		return GetInput(ctx.App(), prompt), true
+	}
+
+	if optional {
+		return "", true
+	}
+
+	fail(ctx.App(), "Missing -%s flag\n", name)
+	return "", false
+}
+
+// setPasswordFlags adds the flags read by resolvePassword to a command.
+func setPasswordFlags(ctx *shell.Context) {
+	ctx.Set("flagPasswordStdin", ctx.FlagSet().Bool("password-stdin", false,
+		"Read the password from the first line of standard input."))
+	ctx.Set("flagPasswordFile", ctx.FlagSet().String("password-file", "",
+		"Read the password from the first line of a file."))
+}
+
+// resolvePassword returns a password read from standard input or a file as
+// requested by the flags added by setPasswordFlags. Otherwise the user is
+// prompted for the password if commands are interactive. If they are not, an
+// empty string is returned if the password is optional or an error is printed
+// and ok is false.
+func resolvePassword(ctx *shell.Context, prompt string, optional bool) (password string, ok bool) {
+	readLine := func(reader *bufio.Reader) (string, bool) {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			fail(ctx.App(), "Got error while reading password:\n%s\n", err)
+			return "", false
+		}
+		return strings.TrimRight(line, "\r\n"), true
+	}
+
+	if path := *ctx.MustGet("flagPasswordFile").(*string); path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			fail(ctx.App(), "Got error while reading password file:\n%s\n", err)
+			return "", false
+		}
+		return readLine(bufio.NewReader(strings.NewReader(string(contents) + "\n")))
+	}
+
+	if *ctx.MustGet("flagPasswordStdin").(*bool) {
+		return readLine(bufio.NewReader(os.Stdin))
+	}
+
+	if interactive {
+		return GetPassword(ctx.App(), prompt), true
+	}
+
+	if optional {
+		return "", true
+	}
+
+	fail(ctx.App(), "Missing password, use -password-stdin or -password-file\n")
+	return "", false
+}
@@ -0,0 +1,303 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/chzyer/readline"
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/models"
+	"github.com/octacian/extensus/shared"
+	"github.com/octacian/shell"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const shellPrompt = "extensus > " // prompt shown before each command
+
+// builtinCommands lists the commands provided by the shell itself.
+var builtinCommands = []string{"help", "exit"}
+
+// lineEditor reads lines typed in the interactive shell. It is nil unless the
+// shell is running in a terminal.
+var lineEditor *readline.Instance
+
+// argumentCompleters maps the full name of a command to a function returning
+// the values its arguments may be completed with.
+var argumentCompleters = map[string]func() []string{
+	"user get":     func() []string { return userIdentifiers(true) },
+	"user change":  func() []string { return userIdentifiers(false) },
+	"user delete":  func() []string { return userIdentifiers(false) },
+	"user restore": func() []string { return userIdentifiers(true) },
+	"user purge":   func() []string { return userIdentifiers(true) },
+	"migrate to":   migrationVersions,
+	"migrate plan": migrationVersions,
+}
+
+// execute runs a single line of input in the shell and returns its exit
+// status.
+func execute(line string) shell.ExitStatus {
+	app := core.GetShell()
+	app.Input = strings.NewReader(line + "\n")
+	return app.Main()
+}
+
+// exitCode returns the process exit code matching the outcome of the commands
+// run since failed and misused were last reset.
+func exitCode() int {
+	switch {
+	case misused:
+		return ExitUsage
+	case failed:
+		return ExitFailure
+	default:
+		return ExitSuccess
+	}
+}
+
+// findCommand returns the registered top-level command with the name given or
+// nil if there is none.
+func findCommand(name string) *shell.Command {
+	for i := range registered {
+		if registered[i].Name == name {
+			return &registered[i]
+		}
+	}
+
+	return nil
+}
+
+// knownCommand returns true if a command or built-in with the name given
+// exists.
+func knownCommand(name string) bool {
+	for _, builtin := range builtinCommands {
+		if name == builtin {
+			return true
+		}
+	}
+
+	return findCommand(name) != nil
+}
+
+// historyPath returns the absolute path of the file shell history is kept in
+// or an empty string if history is not saved.
+func historyPath() string {
+	path := core.GetConfig().Shell.History
+	if path == "" {
+		return ""
+	}
+	return shared.Path(path)
+}
+
+// Shell launches the interactive shell and returns its exit status. When
+// standard input is a terminal, commands are read with history and tab
+// completion. Otherwise commands are read from standard input without
+// prompting for input.
+func Shell() shell.ExitStatus {
+	interactive = terminal.IsTerminal(int(syscall.Stdin))
+	if !interactive {
+		return core.GetShell().Main()
+	}
+
+	history := historyPath()
+	if history != "" {
+		if err := os.MkdirAll(filepath.Dir(history), 0700); err != nil {
+			log.Panic("Shell: got error while creating history directory:\n", err)
+		}
+	}
+
+	editor, err := readline.NewEx(&readline.Config{
+		Prompt:                 shellPrompt,
+		HistoryFile:            history,
+		HistoryLimit:           core.GetConfig().Shell.HistoryLimit,
+		DisableAutoSaveHistory: true,
+		AutoComplete:           &completer{},
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+	})
+	if err != nil {
+		log.Panic("Shell: got error while starting line editor:\n", err)
+	}
+	lineEditor = editor
+	defer func() {
+		lineEditor.Close()
+		lineEditor = nil
+	}()
+
+	for {
+		line, err := lineEditor.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		} else if err == io.EOF {
+			return shell.ExitAll
+		} else if err != nil {
+			log.Panic("Shell: got error while reading command:\n", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := lineEditor.SaveHistory(line); err != nil {
+			log.Warn("Shell: got error while saving history:\n", err)
+		}
+
+		failed, misused = false, false
+		if status := execute(line); status == shell.ExitAll {
+			return status
+		}
+	}
+}
+
+// RunScript runs every line of a file as a shell command without prompting
+// for input and returns a process exit code. Blank lines and lines starting
+// with # are skipped. The script stops at the first command that fails, is
+// used incorrectly or does not exist.
+func RunScript(path string) int {
+	app := core.GetShell()
+	file, err := os.Open(path)
+	if err != nil {
+		app.Printf("Got error while opening script:\n%s\n", err)
+		return ExitFailure
+	}
+	defer file.Close()
+
+	interactive = false
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if name := strings.Fields(line)[0]; !knownCommand(name) {
+			app.Printf("%s:%d: unknown command '%s'\n", path, number, name)
+			return ExitUsage
+		}
+
+		failed, misused = false, false
+		status := execute(line)
+		if code := exitCode(); code != ExitSuccess {
+			app.Printf("%s:%d: stopping after command failed: %s\n", path, number, line)
+			return code
+		}
+		if status == shell.ExitAll {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		app.Printf("Got error while reading script:\n%s\n", err)
+		return ExitFailure
+	}
+
+	return ExitSuccess
+}
+
+// completer implements readline.AutoCompleter for the interactive shell.
+type completer struct{}
+
+// Do returns the ways the word under the cursor can be completed and the
+// length of the word.
+func (completer *completer) Do(line []rune, pos int) ([][]rune, int) {
+	words := strings.Fields(string(line[:pos]))
+	current := ""
+	if len(words) > 0 && !strings.HasSuffix(string(line[:pos]), " ") {
+		current = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	completions := [][]rune{}
+	for _, candidate := range candidates(words) {
+		if strings.HasPrefix(candidate, current) {
+			completions = append(completions, []rune(candidate[len(current):]+" "))
+		}
+	}
+
+	return completions, len([]rune(current))
+}
+
+// candidates returns the words that may follow the words given.
+func candidates(words []string) []string {
+	if len(words) == 0 {
+		names := append([]string{}, builtinCommands...)
+		for _, command := range registered {
+			names = append(names, command.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if words[0] == "help" {
+		if len(words) == 1 {
+			return candidates(nil)
+		}
+		words = words[1:]
+	}
+
+	command := findCommand(words[0])
+	if command == nil {
+		return nil
+	}
+
+	if len(command.SubCommands) > 0 {
+		if len(words) == 1 {
+			names := []string{}
+			for _, subCommand := range command.SubCommands {
+				names = append(names, subCommand.Name)
+			}
+			sort.Strings(names)
+			return names
+		}
+
+		if complete, ok := argumentCompleters[words[0]+" "+words[1]]; ok && len(words) == 2 {
+			return complete()
+		}
+	}
+
+	return nil
+}
+
+// userIdentifiers returns the email and #ID of every user, including deleted
+// users only if withDeleted is true.
+func userIdentifiers(withDeleted bool) []string {
+	lists := []func() ([]models.User, error){models.ListUser}
+	if withDeleted {
+		lists = append(lists, models.ListDeletedUser)
+	}
+
+	identifiers := []string{}
+	for _, list := range lists {
+		users, err := list()
+		if err != nil {
+			continue
+		}
+
+		for _, user := range users {
+			identifiers = append(identifiers, user.Email, fmt.Sprintf("#%d", user.ID))
+		}
+	}
+
+	return identifiers
+}
+
+// migrationVersions returns the version of every migration.
+func migrationVersions() []string {
+	migrations, err := core.ReadMigrations()
+	if err != nil {
+		return nil
+	}
+
+	versions := make([]string, len(migrations))
+	for i, migration := range migrations {
+		versions[i] = fmt.Sprint(migration.Version)
+	}
+
+	return versions
+}
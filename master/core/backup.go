@@ -0,0 +1,383 @@
+package core
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/octacian/extensus/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	backupFormat           = 1         // version of the backup archive format
+	defaultBackupDirectory = "backups" // used if no backup directory is configured
+)
+
+// createTablePattern matches the name of each table created by a migration.
+var createTablePattern = regexp.MustCompile("(?i)CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?`?(\\w+)`?")
+
+// Backup holds the contents of every table created by migrations along with
+// the schema version they were taken at. Tables recording which migrations
+// have been applied are left out, since the schema version already describes
+// them and restoring a backup must not rewrite the migration state of the
+// database it is restored into. Backups are stored as gzip compressed JSON.
+type Backup struct {
+	Format        int           `json:"format"`
+	SchemaVersion int           `json:"schemaVersion"`
+	Created       time.Time     `json:"created"`
+	Tables        []BackupTable `json:"tables"`
+}
+
+// BackupTable holds the contents of a single table. NULL values are stored
+// as nil.
+type BackupTable struct {
+	Name    string      `json:"name"`
+	Columns []string    `json:"columns"`
+	Rows    [][]*string `json:"rows"`
+}
+
+// ErrBackupVersion is returned when a backup was taken at a different schema
+// version than the database is currently at.
+type ErrBackupVersion struct {
+	Backup   int // schema version of the backup
+	Database int // current schema version of the database
+	Latest   int // latest schema version available
+}
+
+// Error implements the error interface for ErrBackupVersion.
+func (err *ErrBackupVersion) Error() string {
+	if err.Backup > err.Latest {
+		return fmt.Sprintf("backup: schema version %d is newer than the latest available version %d", err.Backup,
+			err.Latest)
+	}
+	return fmt.Sprintf("backup: schema version %d does not match database version %d", err.Backup, err.Database)
+}
+
+// quoteIdentifier quotes a table or column name for use in SQL.
+func quoteIdentifier(name string) (string, error) {
+	if strings.ContainsAny(name, "`\x00") {
+		return "", fmt.Errorf("backup: invalid identifier '%s'", name)
+	}
+
+	return "`" + name + "`", nil
+}
+
+// backupValue converts a value scanned from the database into a string that
+// can be inserted again, or nil if the value is NULL.
+func backupValue(table, column string, value interface{}) (*string, error) {
+	var result string
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		if !utf8.Valid(value) {
+			return nil, fmt.Errorf("backup: %s.%s contains binary data", table, column)
+		}
+		result = string(value)
+	case time.Time:
+		result = value.UTC().Format("2006-01-02 15:04:05.999999")
+	default:
+		result = fmt.Sprint(value)
+	}
+
+	return &result, nil
+}
+
+// backupTable reads every row of a table.
+func backupTable(name string) (*BackupTable, error) {
+	quoted, err := quoteIdentifier(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := GetSQLDB().Query("SELECT * FROM " + quoted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := &BackupTable{Name: name, Rows: [][]*string{}}
+	if table.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(table.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make([]*string, len(values))
+		for i, value := range values {
+			if row[i], err = backupValue(name, table.Columns[i], value); err != nil {
+				return nil, err
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, rows.Err()
+}
+
+// dataTables returns the names of the tables created by migrations, which hold
+// the data kept in backups. The tables used to track migrations, whether by
+// this package or by the migration library, are not created by migrations and
+// so are never included.
+func dataTables() (map[string]bool, error) {
+	migrations, err := ReadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]bool)
+	for _, migration := range migrations {
+		for _, match := range createTablePattern.FindAllStringSubmatch(migration.Up, -1) {
+			tables[match[1]] = true
+		}
+	}
+
+	return tables, nil
+}
+
+// WriteBackup writes a compressed backup of every table in the database that
+// was created by a migration.
+func WriteBackup(w io.Writer) error {
+	backup := &Backup{
+		Format:        backupFormat,
+		SchemaVersion: GetMigrate().Version(),
+		Created:       shared.Time(),
+	}
+
+	tables, err := dataTables()
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	if err := GetDB().Select(&names, "SHOW TABLES"); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !tables[name] {
+			continue
+		}
+
+		table, err := backupTable(name)
+		if err != nil {
+			return err
+		}
+		backup.Tables = append(backup.Tables, *table)
+	}
+
+	compressed := gzip.NewWriter(w)
+	if err := json.NewEncoder(compressed).Encode(backup); err != nil {
+		return err
+	}
+
+	return compressed.Close()
+}
+
+// ReadBackup reads a compressed backup written by WriteBackup.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+
+	backup := &Backup{}
+	if err := json.NewDecoder(compressed).Decode(backup); err != nil {
+		return nil, err
+	}
+
+	if backup.Format != backupFormat {
+		return nil, fmt.Errorf("backup: unsupported archive format %d", backup.Format)
+	}
+
+	return backup, nil
+}
+
+// RestoreBackup replaces the contents of every table in the backup within a
+// single transaction. If the backup was taken at a different schema version
+// than the database is at, an ErrBackupVersion is returned unless migrateFirst
+// is true, in which case the database is first migrated to the version of the
+// backup. Tables in the backup that were not created by a migration, such as
+// the migration log kept by backups taken before it was left out, are skipped
+// so that the migration state of the database is left as it is.
+func RestoreBackup(backup *Backup, migrateFirst bool) error {
+	latest, err := LatestMigration()
+	if err != nil {
+		return err
+	}
+
+	versionErr := &ErrBackupVersion{Backup: backup.SchemaVersion, Database: GetMigrate().Version(), Latest: latest}
+	if backup.SchemaVersion > latest {
+		return versionErr
+	}
+	if backup.SchemaVersion != versionErr.Database {
+		if !migrateFirst {
+			return versionErr
+		}
+		if err := MigrateTo(backup.SchemaVersion); err != nil {
+			return err
+		}
+	}
+
+	known, err := dataTables()
+	if err != nil {
+		return err
+	}
+
+	tables := []BackupTable{}
+	for _, table := range backup.Tables {
+		if !known[table.Name] {
+			log.WithFields(log.Fields{"table": table.Name}).Info("Skipping table not created by a migration")
+			continue
+		}
+		tables = append(tables, table)
+	}
+
+	// Foreign key checks are disabled for the session rather than the
+	// transaction, so the restore runs on a connection of its own which is
+	// never returned to the pool with checks still disabled.
+	ctx := context.Background()
+	conn, err := GetSQLDB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=0"); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=1"); err != nil {
+			log.WithFields(log.Fields{"error": err.Error()}).Warn("RestoreBackup: discarding connection after " +
+				"failing to enable foreign key checks")
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := restoreTables(tx, tables); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// restoreTables empties and refills tables using a transaction. Foreign key
+// checks must be disabled on its connection, allowing tables to be restored
+// in any order.
+func restoreTables(tx *sql.Tx, tables []BackupTable) error {
+	for _, table := range tables {
+		name, err := quoteIdentifier(table.Name)
+		if err != nil {
+			return err
+		}
+
+		columns := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			if columns[i], err = quoteIdentifier(column); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM " + name); err != nil {
+			return err
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", name, strings.Join(columns, ", "), placeholders)
+		for _, row := range table.Rows {
+			values := make([]interface{}, len(row))
+			for i, value := range row {
+				if value != nil {
+					values[i] = *value
+				}
+			}
+
+			if _, err := tx.Exec(query, values...); err != nil {
+				return fmt.Errorf("backup: got error while restoring %s: %s", table.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// BackupDirectory returns the absolute path of the directory backups are
+// written to by default.
+func BackupDirectory() string {
+	if dir := GetConfig().Backup.Directory; dir != "" {
+		return shared.Path(dir)
+	}
+
+	return shared.Path(defaultBackupDirectory)
+}
+
+// CreateBackupFile writes a backup to the path provided and returns it. If the
+// path is empty, a file named after the schema version and current time is
+// created in the backup directory.
+func CreateBackupFile(path string) (string, error) {
+	if path == "" {
+		if err := os.MkdirAll(BackupDirectory(), 0755); err != nil {
+			return "", err
+		}
+
+		name := fmt.Sprintf("extensus-v%d-%s.json.gz", GetMigrate().Version(), shared.Time().Format("20060102-150405"))
+		path = filepath.Join(BackupDirectory(), name)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	if err := WriteBackup(file); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, file.Close()
+}
+
+// RestoreBackupFile reads a backup from a file and restores it as described
+// by RestoreBackup.
+func RestoreBackupFile(path string, migrateFirst bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	backup, err := ReadBackup(file)
+	if err != nil {
+		return err
+	}
+
+	return RestoreBackup(backup, migrateFirst)
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestBackupValue ensures that values scanned from the database are converted
+// into strings that can be inserted again.
+func TestBackupValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{[]byte("John Doe"), "John Doe"},
+		{int64(42), "42"},
+		{time.Date(2019, 3, 4, 5, 6, 7, 8000000, time.UTC), "2019-03-04 05:06:07.008"},
+	}
+
+	for _, test := range tests {
+		if got, err := backupValue("test", "column", test.value); err != nil {
+			t.Errorf("backupValue(%v): got error:\n%s", test.value, err)
+		} else if got == nil || *got != test.expected {
+			t.Errorf("backupValue(%v): got %v expected '%s'", test.value, got, test.expected)
+		}
+	}
+
+	if got, err := backupValue("test", "column", nil); err != nil || got != nil {
+		t.Errorf("backupValue(nil): got %v, %v expected nil", got, err)
+	}
+	if _, err := backupValue("test", "column", []byte{0xff, 0xfe}); err == nil {
+		t.Error("backupValue: expected error with binary data")
+	}
+}
+
+// TestReadBackup ensures that backups can be read and that unsupported
+// archive formats are rejected.
+func TestReadBackup(t *testing.T) {
+	write := func(backup *Backup) *bytes.Buffer {
+		buffer := &bytes.Buffer{}
+		compressed := gzip.NewWriter(buffer)
+		if err := json.NewEncoder(compressed).Encode(backup); err != nil {
+			t.Fatal("json.Encode: got error:\n", err)
+		}
+		compressed.Close()
+		return buffer
+	}
+
+	name := "John Doe"
+	backup := &Backup{Format: backupFormat, SchemaVersion: 3, Tables: []BackupTable{
+		{Name: "user", Columns: []string{"Name", "Deleted"}, Rows: [][]*string{{&name, nil}}},
+	}}
+
+	if got, err := ReadBackup(write(backup)); err != nil {
+		t.Error("ReadBackup: got error:\n", err)
+	} else if got.SchemaVersion != 3 || len(got.Tables) != 1 || *got.Tables[0].Rows[0][0] != name {
+		t.Errorf("ReadBackup: got %+v expected %+v", got, backup)
+	} else if got.Tables[0].Rows[0][1] != nil {
+		t.Error("ReadBackup: expected NULL value to be nil")
+	}
+
+	backup.Format = backupFormat + 1
+	if _, err := ReadBackup(write(backup)); err == nil {
+		t.Error("ReadBackup: expected error with unsupported format")
+	}
+}
+
+// TestDataTables ensures that the tables created by migrations are found and
+// that the migration log is left out.
+func TestDataTables(t *testing.T) {
+	tables, err := dataTables()
+	if err != nil {
+		t.Fatal("dataTables: got error:\n", err)
+	}
+
+	for _, name := range []string{"user", "invite", "password_history"} {
+		if !tables[name] {
+			t.Errorf("dataTables: expected table '%s' in %v", name, tables)
+		}
+	}
+	if tables["extensus_migration"] {
+		t.Error("dataTables: expected migration log to be left out")
+	}
+}
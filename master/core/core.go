@@ -22,10 +22,82 @@ type Configuration struct {
 		User     string `json:"user"`
 		Name     string `json:"name"`
 		Password string `json:"password"`
+		Scratch  string `json:"scratch"` // empty database used by the migrate verify command
 	}
-	HashCost int    `json:"bcryptCost"`
-	Address  string `json:"address"`
-	Secret   string `json:"secret"`
+	HashCost int `json:"bcryptCost"`
+	Hasher   struct {
+		Algorithm string `json:"algorithm"` // "bcrypt" or "argon2id", used to hash new passwords
+		Argon2id  struct {
+			Time    uint32 `json:"time"`
+			Memory  uint32 `json:"memory"` // in KiB
+			Threads uint8  `json:"threads"`
+		} `json:"argon2id"`
+	} `json:"hasher"`
+	Address    string `json:"address"`
+	Shutdown   int    `json:"shutdownTimeoutSeconds"` // seconds to wait for requests to finish when stopping
+	URL        string `json:"url"`                    // public URL of the web interface, used in links sent by email
+	Secret     string `json:"secret"`
+	PurgeAfter int    `json:"purgeAfterDays"` // days before deleted users are purged, 0 to disable
+	Avatars    struct {
+		Directory    string `json:"directory"`    // where avatar thumbnails are stored
+		MaxSize      int64  `json:"maxSize"`      // maximum size of uploaded images in bytes
+		MaxDimension int    `json:"maxDimension"` // maximum width or height of uploaded images in pixels
+		Size         int    `json:"size"`         // width and height of thumbnails in pixels
+	} `json:"avatars"`
+	Password struct {
+		MinLength        int    `json:"minLength"`
+		MaxLength        int    `json:"maxLength"` // bcrypt ignores anything past 72 bytes
+		RequireUpper     bool   `json:"requireUpper"`
+		RequireLower     bool   `json:"requireLower"`
+		RequireDigit     bool   `json:"requireDigit"`
+		RequireSymbol    bool   `json:"requireSymbol"`
+		DisallowPersonal bool   `json:"disallowPersonal"` // reject passwords containing the user's name or email
+		BreachedList     string `json:"breachedList"`     // file of breached or common passwords, one per line
+		History          int    `json:"history"`          // number of previous passwords that cannot be reused
+		MaxAge           int    `json:"maxAgeDays"`       // days before a password must be changed, 0 to disable
+	} `json:"password"`
+	Backup struct {
+		Directory     string `json:"directory"`     // where backups are written by default
+		BeforeMigrate bool   `json:"beforeMigrate"` // back up the database before applying new migrations
+	} `json:"backup"`
+	Mail struct {
+		Driver   string `json:"driver"`  // "log" or "smtp"
+		Address  string `json:"address"` // host and port of the SMTP server
+		Username string `json:"username"`
+		Password string `json:"password"`
+		From     string `json:"from"`
+	} `json:"mail"`
+	Shell struct {
+		History      string `json:"history"`      // file commands entered in the shell are kept in, empty to disable
+		HistoryLimit int    `json:"historyLimit"` // maximum number of commands kept
+	} `json:"shell"`
+	Invites struct {
+		ExpireAfter int `json:"expireAfterHours"` // hours before an invitation link stops working
+	} `json:"invites"`
+	Branding struct {
+		Name         string `json:"name"`         // shown in page titles, the header and emails
+		Logo         string `json:"logo"`         // URL or path within public of an image shown in the header
+		PrimaryColor string `json:"primaryColor"` // CSS hex color of buttons, links and icons
+	} `json:"branding"`
+	Security struct {
+		ContentSecurityPolicy string `json:"contentSecurityPolicy"` // replaces the default policy, {nonce} is replaced
+		HSTSMaxAge            int    `json:"hstsMaxAgeSeconds"`     // sent over HTTPS only, 0 to disable
+		FrameOptions          string `json:"frameOptions"`          // X-Frame-Options, DENY unless configured
+		ReferrerPolicy        string `json:"referrerPolicy"`        // Referrer-Policy, same-origin unless configured
+	} `json:"security"`
+}
+
+// defaultBrandName is used if no name is configured under branding.
+const defaultBrandName = "Extensus"
+
+// BrandName returns the name the web interface is presented under, which is
+// Extensus unless another is configured.
+func (config *Configuration) BrandName() string {
+	if config.Branding.Name != "" {
+		return config.Branding.Name
+	}
+
+	return defaultBrandName
 }
 
 var sqlDatabase *sql.DB
@@ -40,17 +112,21 @@ var oneMigrateInstance sync.Once
 var shellApp *shell.App
 var oneShellApp sync.Once
 
-var programConfig Configuration
+var programConfig *Configuration
+var programConfigMutex sync.RWMutex
 var oneProgramConfig sync.Once
 
+// dataSourceName returns the DSN used to connect to a database with the
+// credentials in the configuration file.
+func dataSourceName(database string) string {
+	config := GetConfig()
+	return fmt.Sprintf("%s:%s@/%s?parseTime=true", config.Database.User, config.Database.Password, database)
+}
+
 // GetSQLDB returns a sql.DB for use with packages that do not support sqlx.
 func GetSQLDB() *sql.DB {
 	oneSQLDatabase.Do(func() {
-		config := GetConfig()
-		user := config.Database.User
-		password := config.Database.Password
-		name := config.Database.Name
-		res, err := sql.Open("mysql", fmt.Sprintf("%s:%s@/%s?parseTime=true", user, password, name))
+		res, err := sql.Open("mysql", dataSourceName(GetConfig().Database.Name))
 		if err != nil {
 			log.Panic("GetSQLDB: got error while opening database: ", err)
 		}
@@ -93,7 +169,7 @@ func CloseDB() {
 // GetMigrate returns a migrate.Instance.
 func GetMigrate() *migrate.Instance {
 	oneMigrateInstance.Do(func() {
-		result, err := migrate.NewInstance(GetSQLDB(), shared.Abs("migrations"))
+		result, err := migrate.NewInstance(GetSQLDB(), MigrationsPath())
 		if err != nil {
 			log.Panic("GetMigrate: got error while creating instance: ", err)
 		}
@@ -112,20 +188,60 @@ func GetShell() *shell.App {
 	return shellApp
 }
 
-// GetConfig reads the 'config.json' file at the root of the project and
-// returns a struct with its contents. Any fields not defined within the struct
+// readConfig reads the 'config.json' file in the root directory, which is the
+// working directory unless changed with -root, and returns a struct with its
+// contents. Any fields not defined within the struct
 // are ignored.
+func readConfig() (*Configuration, error) {
+	data, err := ioutil.ReadFile(shared.Path("config.json"))
+	if err != nil {
+		return nil, fmt.Errorf("got error while reading 'config.json': %s", err)
+	}
+
+	config := &Configuration{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("got error while unmarshalling file contents: %s", err)
+	}
+
+	return config, nil
+}
+
+// GetConfig returns the contents of the 'config.json' file at the root of the
+// project, reading it the first time it is called. If any errors occur panic
+// is called.
 func GetConfig() *Configuration {
 	oneProgramConfig.Do(func() {
-		data, err := ioutil.ReadFile(shared.Abs("config.json"))
+		config, err := readConfig()
 		if err != nil {
-			log.Panic("GetConfig: got error while reading 'config.json': ", err)
+			log.Panic("GetConfig: ", err)
 		}
 
-		if err := json.Unmarshal(data, &programConfig); err != nil {
-			log.Panic("GetConfig: got error while unmarshalling file contests: ", err)
-		}
+		programConfigMutex.Lock()
+		programConfig = config
+		programConfigMutex.Unlock()
 	})
 
-	return &programConfig
+	programConfigMutex.RLock()
+	defer programConfigMutex.RUnlock()
+	return programConfig
+}
+
+// ReloadConfig reads the 'config.json' file again and replaces the
+// configuration returned by GetConfig. If the file cannot be read the current
+// configuration is kept and an error is returned. Settings that are only used
+// when something is first set up, such as the database credentials, the
+// password hasher and the mailer, still require a restart to change.
+func ReloadConfig() error {
+	GetConfig()
+
+	config, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("ReloadConfig: %s", err)
+	}
+
+	programConfigMutex.Lock()
+	programConfig = config
+	programConfigMutex.Unlock()
+
+	return nil
 }
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Mailer delivers plain text email messages.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes messages to the log instead of delivering them. It is used
+// when no mail server is configured.
+type LogMailer struct{}
+
+// Send implements the Mailer interface for LogMailer.
+func (mailer *LogMailer) Send(to, subject, body string) error {
+	log.WithFields(log.Fields{"to": to, "subject": subject}).Info("LogMailer: message not delivered:\n", body)
+	return nil
+}
+
+// SMTPMailer delivers messages through an SMTP server. If a username is set
+// the server must support PLAIN authentication.
+type SMTPMailer struct {
+	Address  string // host and port of the server
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements the Mailer interface for SMTPMailer.
+func (mailer *SMTPMailer) Send(to, subject, body string) error {
+	host, _, err := net.SplitHostPort(mailer.Address)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, host)
+	}
+
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n", mailer.From, to, subject, time.Now().Format(time.RFC1123Z))
+	message := header + strings.Replace(body, "\n", "\r\n", -1)
+
+	return smtp.SendMail(mailer.Address, auth, mailer.From, []string{to}, []byte(message))
+}
+
+var programMailer Mailer
+var oneProgramMailer sync.Once
+
+// GetMailer returns the Mailer selected in the configuration file. If the
+// driver is unknown panic is called.
+func GetMailer() Mailer {
+	oneProgramMailer.Do(func() {
+		config := GetConfig().Mail
+		switch config.Driver {
+		case "", "log":
+			programMailer = &LogMailer{}
+		case "smtp":
+			programMailer = &SMTPMailer{Address: config.Address, Username: config.Username,
+				Password: config.Password, From: config.From}
+		default:
+			log.Panicf("GetMailer: unknown mail driver '%s'", config.Driver)
+		}
+	})
+
+	return programMailer
+}
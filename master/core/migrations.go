@@ -0,0 +1,461 @@
+package core
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/octacian/extensus/shared"
+	"github.com/octacian/migrate"
+)
+
+const (
+	markerUp   = "-- @migrate/up"   // marks the start of SQL applied when migrating up
+	markerDown = "-- @migrate/down" // marks the start of SQL applied when migrating down
+)
+
+// migrationTemplate is the contents of files created by NewMigration.
+const migrationTemplate = `-- @migrate/up
+-- SQL applied when migrating up to version %d.
+
+-- @migrate/down
+-- SQL applied when migrating down from version %d.
+`
+
+// validMigrationName is regex to check if the name of a new migration file is
+// valid.
+var validMigrationName = regexp.MustCompile("^[a-z0-9_]+$")
+
+// Migration describes a single version directory within the migrations
+// directory.
+type Migration struct {
+	Version  int
+	Files    []string // names of the SQL files in the version directory, sorted
+	Up       string   // SQL applied when migrating up to this version
+	Down     string   // SQL applied when migrating down from this version
+	Checksum string   // SHA-256 of the names and contents of all files
+}
+
+// MigrationStatus describes whether a Migration has been applied to the
+// database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time // nil if not applied or applied before being recorded
+	Modified  bool       // true if the files changed after being applied
+}
+
+// MigrationStep is a single step taken while migrating between versions.
+type MigrationStep struct {
+	Version int
+	Up      bool   // true if migrating up to Version, false if migrating down from it
+	SQL     string // SQL that will be executed
+}
+
+// migrationLogEntry is a row of the migration log table.
+type migrationLogEntry struct {
+	Version  int
+	Applied  *time.Time
+	Checksum string
+}
+
+// MigrationsPath returns the absolute path to the migrations directory. If the
+// migrations embedded in the binary are used, they are extracted to a
+// temporary directory first.
+func MigrationsPath() string {
+	return shared.AssetPath("migrations")
+}
+
+// parseMigration splits the contents of a migration file into the SQL to be
+// run when migrating up and down. Anything before the first marker is ignored.
+func parseMigration(contents string) (up, down string) {
+	var upSQL, downSQL strings.Builder
+	var target *strings.Builder
+
+	for _, line := range strings.Split(contents, "\n") {
+		switch strings.TrimSpace(line) {
+		case markerUp:
+			target = &upSQL
+		case markerDown:
+			target = &downSQL
+		default:
+			if target != nil {
+				target.WriteString(line + "\n")
+			}
+		}
+	}
+
+	return strings.TrimSpace(upSQL.String()), strings.TrimSpace(downSQL.String())
+}
+
+// ReadMigrations reads every version directory in the migrations directory
+// and returns them sorted by version.
+func ReadMigrations() ([]Migration, error) {
+	dirs, err := ioutil.ReadDir(MigrationsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !strings.HasPrefix(dir.Name(), "version_") {
+			continue
+		}
+
+		version, err := strconv.Atoi(strings.TrimPrefix(dir.Name(), "version_"))
+		if err != nil {
+			return nil, fmt.Errorf("ReadMigrations: invalid version directory '%s'", dir.Name())
+		}
+
+		migration, err := readMigration(version, filepath.Join(MigrationsPath(), dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// readMigration reads all SQL files within a version directory.
+func readMigration(version int, path string) (*Migration, error) {
+	files, err := filepath.Glob(filepath.Join(path, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	migration := &Migration{Version: version}
+	ups, downs := []string{}, []string{}
+	hash := sha256.New()
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.Base(file)
+		migration.Files = append(migration.Files, name)
+		hash.Write([]byte(name))
+		hash.Write(contents)
+
+		up, down := parseMigration(string(contents))
+		if up != "" {
+			ups = append(ups, up)
+		}
+		if down != "" {
+			downs = append(downs, down)
+		}
+	}
+
+	migration.Up = strings.Join(ups, "\n\n")
+	migration.Down = strings.Join(downs, "\n\n")
+	migration.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return migration, nil
+}
+
+// ensureMigrationLog creates the table used to record when migrations were
+// applied and the checksums of their files.
+func ensureMigrationLog() error {
+	_, err := GetDB().Exec(`CREATE TABLE IF NOT EXISTS extensus_migration(
+	Version INT PRIMARY KEY,
+	Applied TIMESTAMP(3) NULL DEFAULT NULL,
+	Checksum CHAR(64) NOT NULL
+)`)
+	return err
+}
+
+// readMigrationLog returns the entries of the migration log by version.
+func readMigrationLog() (map[int]migrationLogEntry, error) {
+	if err := ensureMigrationLog(); err != nil {
+		return nil, err
+	}
+
+	entries := []migrationLogEntry{}
+	if err := GetDB().Select(&entries, "SELECT * FROM extensus_migration"); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	logged := make(map[int]migrationLogEntry)
+	for _, entry := range entries {
+		logged[entry.Version] = entry
+	}
+
+	return logged, nil
+}
+
+// recordMigrations brings the migration log in line with the current database
+// version. Versions newer than since are recorded as applied now, while older
+// versions missing from the log are recorded without a time. Versions above
+// the current version are removed from the log.
+func recordMigrations(since int) error {
+	migrations, err := ReadMigrations()
+	if err != nil {
+		return err
+	}
+
+	logged, err := readMigrationLog()
+	if err != nil {
+		return err
+	}
+
+	current := GetMigrate().Version()
+	now := shared.Time()
+	for _, migration := range migrations {
+		_, recorded := logged[migration.Version]
+		if migration.Version > current {
+			if recorded {
+				if _, err := GetDB().Exec("DELETE FROM extensus_migration WHERE Version=?", migration.Version); err != nil {
+					return err
+				}
+			}
+		} else if !recorded {
+			var applied *time.Time
+			if migration.Version > since {
+				applied = &now
+			}
+
+			if _, err := GetDB().Exec("INSERT INTO extensus_migration (Version, Applied, Checksum) VALUES (?, ?, ?)",
+				migration.Version, applied, migration.Checksum); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// MigrateLatest migrates the database to the latest version and records the
+// migrations applied. If there are no migrations to apply a
+// migrate.ErrNoMigrations is returned.
+func MigrateLatest() error {
+	since := GetMigrate().Version()
+	err := GetMigrate().Latest()
+	if _, ok := err.(*migrate.ErrNoMigrations); err != nil && !ok {
+		return err
+	}
+
+	if recordErr := recordMigrations(since); recordErr != nil {
+		return recordErr
+	}
+
+	return err
+}
+
+// MigrateTo migrates the database to a specific version and records the
+// migrations applied or reverted.
+func MigrateTo(version int) error {
+	since := GetMigrate().Version()
+	if err := GetMigrate().Goto(version); err != nil {
+		return err
+	}
+
+	return recordMigrations(since)
+}
+
+// GetMigrationStatus returns the status of every migration, comparing the
+// files on disk with the migration log.
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := ReadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	logged, err := readMigrationLog()
+	if err != nil {
+		return nil, err
+	}
+
+	current := GetMigrate().Version()
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = MigrationStatus{Migration: migration, Applied: migration.Version <= current}
+		if entry, ok := logged[migration.Version]; ok && statuses[i].Applied {
+			statuses[i].AppliedAt = entry.Applied
+			statuses[i].Modified = entry.Checksum != migration.Checksum
+		}
+	}
+
+	return statuses, nil
+}
+
+// CheckMigrationDrift returns the versions of applied migrations whose files
+// have been modified since they were applied.
+func CheckMigrationDrift() ([]int, error) {
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	drifted := []int{}
+	for _, status := range statuses {
+		if status.Modified {
+			drifted = append(drifted, status.Version)
+		}
+	}
+
+	return drifted, nil
+}
+
+// LatestMigration returns the highest version available in the migrations
+// directory or 0 if there are none.
+func LatestMigration() (int, error) {
+	migrations, err := ReadMigrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// PlanMigration returns the steps that would be taken to migrate the database
+// from its current version to the target version without applying them.
+func PlanMigration(target int) ([]MigrationStep, error) {
+	migrations, err := ReadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	current := GetMigrate().Version()
+	steps := []MigrationStep{}
+	if target >= current {
+		for _, migration := range migrations {
+			if migration.Version > current && migration.Version <= target {
+				steps = append(steps, MigrationStep{Version: migration.Version, Up: true, SQL: migration.Up})
+			}
+		}
+	} else {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if migration := migrations[i]; migration.Version <= current && migration.Version > target {
+				steps = append(steps, MigrationStep{Version: migration.Version, Up: false, SQL: migration.Down})
+			}
+		}
+	}
+
+	return steps, nil
+}
+
+// hasStatements returns true if some SQL contains anything other than
+// comments and whitespace.
+func hasStatements(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateMigrations returns an error for every migration that is missing SQL
+// to migrate up or down. If the migrations cannot be read the error is returned
+// on its own.
+func ValidateMigrations() ([]error, error) {
+	migrations, err := ReadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []error{}
+	for _, migration := range migrations {
+		if !hasStatements(migration.Up) {
+			problems = append(problems, fmt.Errorf("version %d has no SQL in an %s section", migration.Version,
+				markerUp))
+		}
+		if !hasStatements(migration.Down) {
+			problems = append(problems, fmt.Errorf("version %d has no SQL in a %s section", migration.Version,
+				markerDown))
+		}
+	}
+
+	return problems, nil
+}
+
+// NewMigration creates the directory for the next migration version containing
+// a templated SQL file with the name provided and returns the path to the file.
+func NewMigration(name string) (string, error) {
+	if !validMigrationName.MatchString(name) {
+		return "", fmt.Errorf("NewMigration: invalid name '%s', expected lower case letters, digits and underscores",
+			name)
+	}
+
+	if shared.AssetDirectory() == "" {
+		return "", fmt.Errorf("NewMigration: migrations are embedded in the binary, set an asset directory to " +
+			"create new ones")
+	}
+
+	latest, err := LatestMigration()
+	if err != nil {
+		return "", err
+	}
+
+	version := latest + 1
+	dir := filepath.Join(MigrationsPath(), fmt.Sprintf("version_%d", version))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name+".sql")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(migrationTemplate, version, version)), 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// VerifyMigrations applies every migration up, down and up again against the
+// scratch database named in the configuration file to prove that they are
+// reversible. The scratch database is left at the latest version.
+func VerifyMigrations() error {
+	name := GetConfig().Database.Scratch
+	if name == "" {
+		return fmt.Errorf("VerifyMigrations: no scratch database configured")
+	}
+	if name == GetConfig().Database.Name {
+		return fmt.Errorf("VerifyMigrations: scratch database must not be the main database")
+	}
+
+	db, err := sql.Open("mysql", dataSourceName(name))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	instance, err := migrate.NewInstance(db, MigrationsPath())
+	if err != nil {
+		return err
+	}
+
+	steps := []struct {
+		description string
+		run         func() error
+	}{
+		{"resetting scratch database", func() error { return instance.Goto(0) }},
+		{"migrating up", instance.Latest},
+		{"migrating down", func() error { return instance.Goto(0) }},
+		{"migrating up again", instance.Latest},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			if _, ok := err.(*migrate.ErrNoMigrations); !ok {
+				return fmt.Errorf("VerifyMigrations: got error while %s: %s", step.description, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/octacian/extensus/shared"
+)
+
+// TestMain reads config.json from the root of the source tree rather than the
+// directory of the package.
+func TestMain(m *testing.M) {
+	shared.SetRootDirectory(shared.Abs("."))
+	os.Exit(m.Run())
+}
+
+// TestParseMigration ensures that migration files are split into up and down
+// sections using the migrate markers.
+func TestParseMigration(t *testing.T) {
+	up, down := parseMigration(`-- leading comment is ignored
+-- @migrate/up
+CREATE TABLE test(ID INT);
+
+-- @migrate/down
+DROP TABLE test;
+`)
+
+	if up != "CREATE TABLE test(ID INT);" {
+		t.Errorf("parseMigration: got up SQL '%s'", up)
+	}
+	if down != "DROP TABLE test;" {
+		t.Errorf("parseMigration: got down SQL '%s'", down)
+	}
+}
+
+// TestReadMigrations ensures that the migrations shipped with the project can
+// be read and are sorted by version.
+func TestReadMigrations(t *testing.T) {
+	migrations, err := ReadMigrations()
+	if err != nil {
+		t.Fatal("ReadMigrations: got error:\n", err)
+	}
+
+	for i, migration := range migrations {
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			t.Errorf("ReadMigrations: version %d is not sorted", migration.Version)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			t.Errorf("ReadMigrations: version %d is missing up or down SQL", migration.Version)
+		}
+		if len(migration.Checksum) != 64 {
+			t.Errorf("ReadMigrations: version %d has invalid checksum '%s'", migration.Version, migration.Checksum)
+		}
+	}
+}
+
+// TestValidateMigrations ensures that the migrations shipped with the project
+// all have up and down SQL and that comment-only sections are not accepted.
+func TestValidateMigrations(t *testing.T) {
+	if problems, err := ValidateMigrations(); err != nil {
+		t.Error("ValidateMigrations: got error:\n", err)
+	} else {
+		for _, problem := range problems {
+			t.Error("ValidateMigrations: got problem:\n", problem)
+		}
+	}
+
+	if hasStatements("-- SQL applied when migrating up.\n\n") {
+		t.Error("hasStatements: expected false with only comments")
+	}
+	if !hasStatements("-- Create table\nCREATE TABLE test(ID INT);") {
+		t.Error("hasStatements: expected true with a statement")
+	}
+}
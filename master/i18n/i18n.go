@@ -0,0 +1,332 @@
+// Package i18n loads the message catalogs used to translate the web interface
+// and shell, and chooses the locale each request or user is served in.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/octacian/extensus/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLocale is used when no other locale is chosen and provides the
+	// messages missing from other locales.
+	DefaultLocale = "en"
+
+	// nameKey is the key of the message naming a locale in its own language.
+	nameKey = "locale.name"
+)
+
+var (
+	// locales maps the tag of every locale to the locale itself.
+	locales      map[string]*Locale
+	localesMutex sync.RWMutex
+	localesOnce  sync.Once
+)
+
+// contextKey is an unexported type for keys defined in this package for use
+// with context.WithValue.
+type contextKey int
+
+// localeContextKey is the key for Locale values in Contexts. Clients must use
+// Locale.NewContext and i18n.FromContext.
+var localeContextKey contextKey
+
+// Message is a translated message. Messages that depend on a count have a
+// form for each plural category used by the language, such as one and other
+// in English; other messages only have the other form.
+type Message map[string]string
+
+// UnmarshalJSON implements json.Unmarshaler for Message, accepting either a
+// string or an object mapping plural categories to forms.
+func (message *Message) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*message = Message{"other": single}
+		return nil
+	}
+
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return fmt.Errorf("expected a string or an object of plural forms")
+	}
+	if _, ok := forms["other"]; !ok {
+		return fmt.Errorf("plural forms must include other")
+	}
+
+	*message = Message(forms)
+	return nil
+}
+
+// Locale is a message catalog for a language, read from locales/<tag>.json.
+type Locale struct {
+	Tag      string // language tag such as en or pt-BR
+	Name     string // name of the language in the language itself
+	messages map[string]Message
+}
+
+// Has returns true if the locale or the default locale has a message with the
+// key given.
+func (locale *Locale) Has(key string) bool {
+	_, ok := locale.lookup(key)
+	return ok
+}
+
+// lookup returns the message with the key given, falling back to the default
+// locale if the locale does not have it.
+func (locale *Locale) lookup(key string) (Message, bool) {
+	if message, ok := locale.messages[key]; ok {
+		return message, true
+	}
+
+	if locale.Tag != DefaultLocale {
+		if fallback, ok := getLocales()[DefaultLocale]; ok {
+			message, ok := fallback.messages[key]
+			return message, ok
+		}
+	}
+
+	return nil, false
+}
+
+// T returns the message with the key given, formatted with the arguments as
+// with fmt.Sprintf. If the message has plural forms, the first argument is the
+// count used to choose between them. If neither the locale nor the default
+// locale have the message, the key itself is returned.
+func (locale *Locale) T(key string, args ...interface{}) string {
+	message, ok := locale.lookup(key)
+	if !ok {
+		return key
+	}
+
+	form := message["other"]
+	if len(message) > 1 && len(args) > 0 {
+		if count, err := toInt64(args[0]); err == nil {
+			if plural, ok := message[PluralCategory(locale.Tag, count)]; ok {
+				form = plural
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		return form
+	}
+	return fmt.Sprintf(form, args...)
+}
+
+// NewContext returns a new context.Context that carries this locale.
+func (locale *Locale) NewContext(parent context.Context) context.Context {
+	return context.WithValue(parent, localeContextKey, locale)
+}
+
+// FromContext returns the Locale value stored in a context or the default
+// locale if there is none.
+func FromContext(ctx context.Context) *Locale {
+	if locale, ok := ctx.Value(localeContextKey).(*Locale); ok {
+		return locale
+	}
+
+	return Default()
+}
+
+// PluralCategory returns the plural category a count falls into in the
+// language of a tag: one or other.
+func PluralCategory(tag string, count int64) string {
+	switch language(tag) {
+	case "fr", "pt":
+		if count == 0 || count == 1 || count == -1 {
+			return "one"
+		}
+	case "ja", "ko", "zh":
+	default:
+		if count == 1 || count == -1 {
+			return "one"
+		}
+	}
+
+	return "other"
+}
+
+// language returns the language of a tag without its region, e.g. pt for
+// pt-BR.
+func language(tag string) string {
+	return strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+}
+
+// toInt64 converts any integer or float value into an int64.
+func toInt64(value interface{}) (int64, error) {
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflected.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(reflected.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(reflected.Float()), nil
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+}
+
+// readLocales reads every catalog in the top-level locales directory, read
+// from the asset directory if one is set or from the embedded copies
+// otherwise.
+func readLocales() (map[string]*Locale, error) {
+	assets := shared.Assets("locales")
+	paths, err := fs.Glob(assets, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	read := make(map[string]*Locale)
+	for _, file := range paths {
+		contents, err := fs.ReadFile(assets, file)
+		if err != nil {
+			return nil, fmt.Errorf("i18n: got error while reading %s: %s", file, err)
+		}
+
+		locale := &Locale{Tag: strings.TrimSuffix(path.Base(file), ".json")}
+		if err := json.Unmarshal(contents, &locale.messages); err != nil {
+			return nil, fmt.Errorf("i18n: got error while parsing %s: %s", file, err)
+		}
+
+		locale.Name = locale.Tag
+		if name, ok := locale.messages[nameKey]; ok {
+			locale.Name = name["other"]
+		}
+		read[locale.Tag] = locale
+	}
+
+	if _, ok := read[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("i18n: missing catalog for default locale %s", DefaultLocale)
+	}
+
+	return read, nil
+}
+
+// Reload reads every message catalog again. If any catalog cannot be read the
+// locales loaded before are kept and the error is returned.
+func Reload() error {
+	read, err := readLocales()
+	if err != nil {
+		return err
+	}
+
+	localesMutex.Lock()
+	locales = read
+	localesMutex.Unlock()
+
+	return nil
+}
+
+// getLocales returns every locale, reading the catalogs the first time it is
+// called. If the catalogs cannot be read panic is called.
+func getLocales() map[string]*Locale {
+	localesOnce.Do(func() {
+		if err := Reload(); err != nil {
+			log.Panic("i18n.getLocales: got error:\n", err)
+		}
+	})
+
+	localesMutex.RLock()
+	defer localesMutex.RUnlock()
+	return locales
+}
+
+// Default returns the default locale.
+func Default() *Locale {
+	return getLocales()[DefaultLocale]
+}
+
+// Get returns the locale with the tag given, ignoring case.
+func Get(tag string) (*Locale, bool) {
+	for _, locale := range getLocales() {
+		if strings.EqualFold(locale.Tag, tag) {
+			return locale, true
+		}
+	}
+
+	return nil, false
+}
+
+// List returns every locale sorted by tag.
+func List() []*Locale {
+	list := []*Locale{}
+	for _, locale := range getLocales() {
+		list = append(list, locale)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tag < list[j].Tag })
+
+	return list
+}
+
+// match returns the locale best matching a language tag: the locale with the
+// tag itself, or else the locale for its language without a region.
+func match(tag string) (*Locale, bool) {
+	tag = strings.Replace(strings.TrimSpace(tag), "_", "-", -1)
+	if tag == "" || tag == "*" {
+		return nil, false
+	}
+	if locale, ok := Get(tag); ok {
+		return locale, true
+	}
+
+	return Get(language(tag))
+}
+
+// Negotiate returns the locale best matching the value of an Accept-Language
+// header, e.g. "es-MX,es;q=0.9,en;q=0.8", or the default locale if none
+// match.
+func Negotiate(acceptLanguage string) *Locale {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	preferences := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		pref := preference{tag: strings.TrimSpace(fields[0]), quality: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if quality, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					pref.quality = quality
+				}
+			}
+		}
+		if pref.quality > 0 {
+			preferences = append(preferences, pref)
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+
+	for _, pref := range preferences {
+		if locale, ok := match(pref.tag); ok {
+			return locale
+		}
+	}
+
+	return Default()
+}
+
+// FromEnvironment returns the locale best matching a POSIX locale name such as
+// the value of LANG, e.g. "es_ES.UTF-8", or the default locale if none match.
+func FromEnvironment(name string) *Locale {
+	name = strings.SplitN(strings.SplitN(name, ".", 2)[0], "@", 2)[0]
+	if locale, ok := match(name); ok {
+		return locale
+	}
+
+	return Default()
+}
@@ -0,0 +1,87 @@
+package i18n
+
+import "testing"
+
+// TestNegotiate ensures that the locale best matching an Accept-Language
+// header is chosen.
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                             DefaultLocale,
+		"*":                            DefaultLocale,
+		"es":                           "es",
+		"es-MX,es;q=0.9,en;q=0.8":      "es",
+		"fr-CA, en;q=0.5, es;q=0.7":    "es",
+		"EN-gb":                        "en",
+		"es;q=0, en;q=0.1":             "en",
+		"de-DE,de;q=0.9":               DefaultLocale,
+		"en;q=0.2, es-ES;q=0.4, *;q=1": "es",
+	}
+
+	for header, expected := range tests {
+		if got := Negotiate(header).Tag; got != expected {
+			t.Errorf("Negotiate(%q): got '%s' expected '%s'", header, got, expected)
+		}
+	}
+}
+
+// TestFromEnvironment ensures that POSIX locale names are matched.
+func TestFromEnvironment(t *testing.T) {
+	tests := map[string]string{
+		"es_ES.UTF-8":     "es",
+		"en_US@euro":      "en",
+		"C":               DefaultLocale,
+		"pt_BR.ISO8859-1": DefaultLocale,
+	}
+
+	for name, expected := range tests {
+		if got := FromEnvironment(name).Tag; got != expected {
+			t.Errorf("FromEnvironment(%q): got '%s' expected '%s'", name, got, expected)
+		}
+	}
+}
+
+// TestT ensures that messages are formatted, pluralized and fall back to the
+// default locale.
+func TestT(t *testing.T) {
+	locale := &Locale{Tag: "es", messages: map[string]Message{
+		"greeting": {"other": "Hola, %s"},
+		"users":    {"one": "%d usuario", "other": "%d usuarios"},
+	}}
+
+	tests := []struct {
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{"greeting", []interface{}{"Ana"}, "Hola, Ana"},
+		{"users", []interface{}{1}, "1 usuario"},
+		{"users", []interface{}{uint64(0)}, "0 usuarios"},
+		{"users", []interface{}{12}, "12 usuarios"},
+		{"login.submit", nil, Default().T("login.submit")},
+		{"missing.key", nil, "missing.key"},
+	}
+
+	for _, test := range tests {
+		if got := locale.T(test.key, test.args...); got != test.expected {
+			t.Errorf("Locale.T(%q, %v): got '%s' expected '%s'", test.key, test.args, got, test.expected)
+		}
+	}
+}
+
+// TestCatalogsComplete ensures that every catalog translates every message in
+// the default catalog and nothing else.
+func TestCatalogsComplete(t *testing.T) {
+	base := Default()
+	for _, locale := range List() {
+		for key := range base.messages {
+			if _, ok := locale.messages[key]; !ok {
+				t.Errorf("locale %s: missing message %s", locale.Tag, key)
+			}
+		}
+		for key := range locale.messages {
+			if _, ok := base.messages[key]; !ok {
+				t.Errorf("locale %s: unknown message %s", locale.Tag, key)
+			}
+		}
+	}
+}
@@ -1,25 +1,46 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"runtime"
-
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
 
 	"github.com/octacian/extensus/master/commands"
 	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/models"
 	"github.com/octacian/extensus/master/routes"
+	"github.com/octacian/extensus/master/static"
+	"github.com/octacian/extensus/master/template"
+	"github.com/octacian/extensus/shared"
 	"github.com/octacian/migrate"
 	"github.com/octacian/shell"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	exitCode := commands.ExitSuccess
+
 	// Deferred tasks
-	defer os.Exit(0)        // finally, exit
-	defer core.CloseSQLDB() // second, close sql.DB
-	defer core.CloseDB()    // first, close sqlx.DB
+	defer func() { // finally, exit
+		// A panic, such as from log.Panic when setup fails, must not be
+		// reported as success.
+		if recovered := recover(); recovered != nil {
+			if _, logged := recovered.(*log.Entry); !logged {
+				fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", recovered, debug.Stack())
+			}
+			exitCode = commands.ExitFailure
+		}
+		os.Exit(exitCode)
+	}()
+	defer core.CloseSQLDB()              // third, close sql.DB
+	defer core.CloseDB()                 // second, close sqlx.DB
+	defer shared.RemoveExtractedAssets() // first, remove extracted assets
 
 	log.SetOutput(os.Stdout)
 	log.SetFormatter(&log.TextFormatter{
@@ -34,38 +55,162 @@ func main() {
 
 	// Prepare command-line flags
 	flagNoMigrate := flag.Bool("no-migrate", false, "do not apply new migrations")
+	flagMigrateDryRun := flag.Bool("migrate-dry-run", false, "print the SQL new migrations would run and exit")
+	flagRoot := flag.String("root", "", "directory config.json is read from and relative paths within it are "+
+		"resolved against (defaults to the working directory)")
+	flagAssets := flag.String("assets", "", "read templates, migrations and static files from this directory "+
+		"instead of the copies embedded in the binary (defaults to the source tree in development mode)")
+	flagOutput := flag.String("output", "text", "format commands print information in: "+
+		strings.Join(commands.OutputFormats, ", "))
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [shell [-f script] | <command> [<sub-command>] [flags] "+
+			"[arguments]]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 
 	flag.Parse() // Parse flags
 
-	// Ensure there are not too many trailing arguments
-	if flag.NArg() > 1 {
-		log.Panicf("got %d trailing command-line arguments expected 0 to 1: %s", flag.NArg(), os.Args)
+	if err := commands.SetOutput(*flagOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = commands.ExitUsage
+		return
+	}
+
+	shared.SetRootDirectory(*flagRoot)
+
+	// In development mode assets are read from the root directory if it holds
+	// the source tree, so that changes are picked up without rebuilding.
+	if *flagAssets == "" && os.Getenv("MODE") == "DEV" {
+		if info, err := os.Stat(shared.Path("templates")); err == nil && info.IsDir() {
+			*flagAssets = shared.Path(".")
+		}
+	}
+	shared.SetAssetDirectory(*flagAssets)
+
+	// if the migrate dry run flag is true, print the pending migrations and exit
+	if *flagMigrateDryRun {
+		latest, err := core.LatestMigration()
+		if err != nil {
+			log.Panic("main: got error while reading migrations:\n", err)
+		}
+
+		steps, err := core.PlanMigration(latest)
+		if err != nil {
+			log.Panic("main: got error while planning migrations:\n", err)
+		}
+
+		fmt.Print(commands.FormatMigrationPlan(steps))
+		return
 	}
 
 	// if the no migrate flag is not true, automatically migrate the database
 	if !*flagNoMigrate {
-		instance := core.GetMigrate()
-		if err := instance.Latest(); err != nil {
+		// Back up existing data first if there are migrations to apply
+		if core.GetConfig().Backup.BeforeMigrate && core.GetMigrate().Version() > 0 {
+			if latest, err := core.LatestMigration(); err != nil {
+				log.Panic("main: got error while reading migrations:\n", err)
+			} else if latest > core.GetMigrate().Version() {
+				path, err := core.CreateBackupFile("")
+				if err != nil {
+					log.Panic("main: got error while backing up database before migrating:\n", err)
+				}
+				log.WithFields(log.Fields{"path": path}).Info("Backed up database before migrating")
+			}
+		}
+
+		if err := core.MigrateLatest(); err != nil {
 			switch err.(type) {
 			case *migrate.ErrNoMigrations:
-				log.WithFields(log.Fields{"version": instance.Version()}).Info("No database migrations to apply")
+				log.WithFields(log.Fields{"version": core.GetMigrate().Version()}).Info("No database migrations to apply")
 			default:
 				log.Panic("main: got error while migrating to latest:\n", err)
 			}
 		}
 	}
 
+	// Warn about applied migrations that have been edited since
+	if drifted, err := core.CheckMigrationDrift(); err != nil {
+		log.Error("main: got error while checking for modified migrations:\n", err)
+	} else {
+		for _, version := range drifted {
+			log.WithFields(log.Fields{"version": version}).Warn("Applied migration has been modified since it was applied")
+		}
+	}
+
+	// Permanently remove users that have been deleted for longer than the purge period
+	if count, err := models.PurgeExpiredUsers(); err != nil {
+		log.Error("main: got error while purging deleted users:\n", err)
+	} else if count > 0 {
+		log.WithFields(log.Fields{"count": count}).Info("Purged deleted users")
+	}
+
 	// if the trailing argument is equal to shell, launch the shell
 	if flag.Arg(0) == "shell" {
+		shellFlags := flag.NewFlagSet("shell", flag.ContinueOnError)
+		flagScript := shellFlags.String("f", "", "run commands from a script file and exit")
+		if err := shellFlags.Parse(flag.Args()[1:]); err != nil {
+			exitCode = commands.ExitUsage
+			return
+		}
+
 		// Register all commands
 		commands.Register()
-		exitStatus := core.GetShell().Main()
+
+		// if a script is given, run it instead of the interactive shell
+		if *flagScript != "" {
+			exitCode = commands.RunScript(*flagScript)
+			return
+		}
+
+		exitStatus := commands.Shell()
 		// Handle exitStatus
 		if exitStatus == shell.ExitAll {
-			fmt.Printf("Received exit code of %d, exiting...", exitStatus)
-			runtime.Goexit()
+			fmt.Printf("Received exit code of %d, exiting...\n", exitStatus)
+			return
+		}
+	} else if flag.NArg() > 0 {
+		// Otherwise run the command given by the trailing arguments and exit
+		commands.Register()
+		exitCode = commands.Run(flag.Args())
+		return
+	}
+
+	// Serve until asked to stop, reloading the configuration and templates
+	// whenever SIGHUP is received
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for range hangup {
+			reload()
 		}
+	}()
+
+	if err := routes.Serve(ctx); err != nil {
+		log.Error("main: ", err)
+		exitCode = commands.ExitFailure
 	}
+}
 
-	routes.Serve()
+// reload reads the configuration file, message catalogs, stylesheets and
+// templates again without stopping the HTTP server. If any of them cannot be
+// read the current ones are kept.
+func reload() {
+	log.Info("Received SIGHUP, reloading configuration, stylesheets and templates")
+	if err := core.ReloadConfig(); err != nil {
+		log.Error("main: ", err)
+	}
+	if err := i18n.Reload(); err != nil {
+		log.Error("main: keeping previous message catalogs after error:\n", err)
+	}
+	if err := static.Build(); err != nil {
+		log.Error("main: keeping previous stylesheets after error:\n", err)
+	}
+	if err := template.Reload(); err != nil {
+		log.Error("main: keeping previous templates after error:\n", err)
+	}
 }
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // Register GIF decoder for avatar uploads
+	_ "image/jpeg" // Register JPEG decoder for avatar uploads
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAvatarDirectory    = "data/avatars" // used if no directory is configured
+	defaultAvatarMaxSize      = 1 << 20        // used if no maximum size is configured
+	defaultAvatarMaxDimension = 4096           // used if no maximum dimension is configured
+	defaultAvatarSize         = 128            // used if no thumbnail size is configured
+)
+
+// avatarTypes lists the content types accepted for avatar uploads.
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// AvatarDirectory returns the absolute path of the directory avatar
+// thumbnails are stored in.
+func AvatarDirectory() string {
+	if dir := core.GetConfig().Avatars.Directory; dir != "" {
+		return shared.Path(dir)
+	}
+
+	return shared.Path(defaultAvatarDirectory)
+}
+
+// AvatarPath returns the absolute path to the user's avatar thumbnail or an
+// empty string if the user has no avatar.
+func (user *User) AvatarPath() string {
+	if user.Avatar == "" {
+		return ""
+	}
+
+	return filepath.Join(AvatarDirectory(), user.Avatar)
+}
+
+// SetAvatar reads an uploaded image, validates its size and type, and stores a
+// square thumbnail of it on disk. The name is only used to describe the upload
+// in errors. The user must be saved first and must be saved again afterwards to
+// persist the new file name, at which point any previous avatar is removed. If
+// that save fails the new thumbnail is removed instead. If the image is too
+// large or of an unsupported type an ErrInvalid is returned. If anything else
+// goes wrong it is returned.
+func (user *User) SetAvatar(name string, r io.Reader) error {
+	if user.ID == 0 {
+		return fmt.Errorf("User.SetAvatar: user must be saved before setting an avatar")
+	}
+
+	maxSize := core.GetConfig().Avatars.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultAvatarMaxSize
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > maxSize {
+		return &ErrInvalid{Model: "user", Which: "avatar", Value: name}
+	}
+	if !avatarTypes[http.DetectContentType(data)] {
+		return &ErrInvalid{Model: "user", Which: "avatar", Value: name}
+	}
+
+	// A small file can declare enormous dimensions, so they are checked before
+	// the pixels are decoded.
+	maxDimension := core.GetConfig().Avatars.MaxDimension
+	if maxDimension <= 0 {
+		maxDimension = defaultAvatarMaxDimension
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return &ErrInvalid{Model: "user", Which: "avatar", Value: name}
+	}
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return &ErrInvalid{Model: "user", Which: "avatar", Value: name, Code: "dimensions",
+			Reason: fmt.Sprintf("must be no larger than %d by %d pixels", maxDimension, maxDimension),
+			Args:   []interface{}{maxDimension, maxDimension}}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return &ErrInvalid{Model: "user", Which: "avatar", Value: name}
+	}
+
+	size := core.GetConfig().Avatars.Size
+	if size <= 0 {
+		size = defaultAvatarSize
+	}
+
+	dir := AvatarDirectory()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file := fmt.Sprintf("%d-%d.png", user.ID, shared.Time().UnixNano())
+	if err := writeThumbnail(filepath.Join(dir, file), thumbnail(img, size)); err != nil {
+		return err
+	}
+
+	// A thumbnail stored by an earlier call was never saved, so it is removed
+	// rather than remembered as the avatar to replace.
+	if user.unsavedAvatar != "" {
+		if err := os.Remove(filepath.Join(dir, user.unsavedAvatar)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		user.replacedAvatar = user.Avatar
+	}
+	user.unsavedAvatar = file
+	user.Avatar = file
+	return nil
+}
+
+// writeThumbnail encodes an image as a PNG file at the path provided. If
+// anything goes wrong the partially written file is removed and the error is
+// returned.
+func writeThumbnail(path string, img image.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(out, img)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+// discardAvatar removes a thumbnail stored by SetAvatar that was never saved
+// and restores the avatar it was to replace. It is called when saving fails.
+func (user *User) discardAvatar() {
+	if user.unsavedAvatar == "" {
+		return
+	}
+
+	if err := os.Remove(filepath.Join(AvatarDirectory(), user.unsavedAvatar)); err != nil && !os.IsNotExist(err) {
+		log.Warn("User.discardAvatar: got error while removing unsaved avatar:\n", err)
+	}
+	user.Avatar = user.replacedAvatar
+	user.replacedAvatar = ""
+	user.unsavedAvatar = ""
+}
+
+// removeAvatar deletes the user's avatar thumbnail from disk, if any.
+func (user *User) removeAvatar() error {
+	if path := user.AvatarPath(); path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	user.Avatar = ""
+	return nil
+}
+
+// thumbnail crops the centre square out of an image and scales it to the size
+// provided by averaging the pixels covered by each pixel of the result.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	left := bounds.Min.X + (bounds.Dx()-side)/2
+	top := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	result := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := top+y*side/size, top+(y+1)*side/size
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := left+x*side/size, left+(x+1)*side/size
+			if x1 == x0 {
+				x1++
+			}
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+
+			result.Set(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+
+	return result
+}
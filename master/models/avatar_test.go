@@ -0,0 +1,80 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestThumbnail ensures that thumbnails are cropped to the centre square of an
+// image and scaled to the requested size.
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			if x >= 100 && x < 200 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	thumb := thumbnail(img, 32)
+	if bounds := thumb.Bounds(); bounds.Dx() != 32 || bounds.Dy() != 32 {
+		t.Fatalf("thumbnail: got size %dx%d expected 32x32", bounds.Dx(), bounds.Dy())
+	}
+
+	for _, point := range []image.Point{{0, 0}, {31, 31}, {16, 16}} {
+		if r, _, b, _ := thumb.At(point.X, point.Y).RGBA(); r != 0xffff || b != 0 {
+			t.Errorf("thumbnail.At(%d, %d): expected pixel from centre of image", point.X, point.Y)
+		}
+	}
+
+	thumb = thumbnail(image.NewRGBA(image.Rect(0, 0, 10, 10)), 64)
+	if bounds := thumb.Bounds(); bounds.Dx() != 64 || bounds.Dy() != 64 {
+		t.Errorf("thumbnail: got size %dx%d expected 64x64 when enlarging", bounds.Dx(), bounds.Dy())
+	}
+}
+
+// TestSetAvatarDimensions ensures that images declaring dimensions larger than
+// the maximum are rejected before they are decoded and nothing is stored.
+func TestSetAvatarDimensions(t *testing.T) {
+	var data bytes.Buffer
+	if err := png.Encode(&data, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal("png.Encode: got error:\n", err)
+	}
+
+	// Rewrite the dimensions in the header chunk and its checksum.
+	header := data.Bytes()
+	binary.BigEndian.PutUint32(header[16:20], 50000)
+	binary.BigEndian.PutUint32(header[20:24], 50000)
+	binary.BigEndian.PutUint32(header[29:33], crc32.ChecksumIEEE(header[12:29]))
+
+	user := &User{ID: 1}
+	err := user.SetAvatar("bomb.png", bytes.NewReader(header))
+	if invalid, ok := err.(*ErrInvalid); !ok || invalid.Code != "dimensions" {
+		t.Fatal("User.SetAvatar: expected ErrInvalid for oversized image got:", err)
+	}
+	if user.Avatar != "" || user.unsavedAvatar != "" {
+		t.Errorf("User.SetAvatar: expected no avatar to be stored, got '%s'", user.Avatar)
+	}
+}
+
+// TestWriteThumbnail ensures that a thumbnail which cannot be written leaves no
+// file behind.
+func TestWriteThumbnail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.png")
+	if err := writeThumbnail(path, image.NewRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Fatal("writeThumbnail: expected error for empty image")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("writeThumbnail: expected partial file to be removed, got: %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
+import "sync"
+
 var cache = make(map[interface{}]Cacheable)
+var cacheMutex sync.RWMutex
 
 // Cacheable is any type containing a method to refresh the contents of the
 // instance given an identifier.
@@ -12,7 +15,10 @@ type Cacheable interface {
 // the wanted instance, returning a cached instance or attempting to fetch
 // the item if it is not cached. If an error occurs it is returned.
 func Cache(item Cacheable, identifier interface{}) (Cacheable, error) {
-	if cached, ok := cache[identifier]; ok {
+	cacheMutex.RLock()
+	cached, ok := cache[identifier]
+	cacheMutex.RUnlock()
+	if ok {
 		return cached, nil
 	}
 
@@ -20,6 +26,16 @@ func Cache(item Cacheable, identifier interface{}) (Cacheable, error) {
 		return nil, err
 	}
 
+	cacheMutex.Lock()
 	cache[identifier] = item
+	cacheMutex.Unlock()
 	return item, nil
 }
+
+// Uncache removes the item stored under an identifier, if any, so that the
+// next call to Cache fetches it again.
+func Uncache(identifier interface{}) {
+	cacheMutex.Lock()
+	delete(cache, identifier)
+	cacheMutex.Unlock()
+}
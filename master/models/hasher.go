@@ -0,0 +1,252 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/octacian/extensus/master/core"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrMismatchedPassword is returned when a plaintext password does not match
+// a hash.
+var ErrMismatchedPassword = errors.New("models: hash does not match password")
+
+// ErrUnknownHash is returned when no Hasher recognizes the format of a hash.
+var ErrUnknownHash = errors.New("models: hash was produced by an unknown algorithm")
+
+// Hasher hashes plaintext passwords and verifies them against hashes. Hashes
+// describe the algorithm and parameters used to produce them so that they can
+// still be verified after the configured Hasher changes.
+type Hasher interface {
+	// Hash returns a self-describing hash of the plaintext password.
+	Hash(password []byte) ([]byte, error)
+	// Compare returns nil if the plaintext password matches the hash.
+	Compare(hash, password []byte) error
+	// Handles returns true if the hash was produced by the same algorithm.
+	Handles(hash []byte) bool
+	// NeedsRehash returns true if the hash uses different parameters.
+	NeedsRehash(hash []byte) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt. Passwords longer than 72 bytes
+// are truncated by the algorithm.
+type BcryptHasher struct {
+	Cost int // bcrypt.DefaultCost is used if below bcrypt.MinCost
+}
+
+// cost returns the cost hashes are produced with, which bcrypt raises to the
+// default if it is below the minimum.
+func (hasher *BcryptHasher) cost() int {
+	if hasher.Cost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+
+	return hasher.Cost
+}
+
+// Hash implements Hasher.Hash for BcryptHasher.
+func (hasher *BcryptHasher) Hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, hasher.cost())
+}
+
+// Compare implements Hasher.Compare for BcryptHasher.
+func (hasher *BcryptHasher) Compare(hash, password []byte) error {
+	return bcrypt.CompareHashAndPassword(hash, password)
+}
+
+// Handles implements Hasher.Handles for BcryptHasher.
+func (hasher *BcryptHasher) Handles(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) || bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+// NeedsRehash implements Hasher.NeedsRehash for BcryptHasher.
+func (hasher *BcryptHasher) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != hasher.cost()
+}
+
+// Argon2idHasher hashes passwords with argon2id, encoding hashes in the PHC
+// string format (e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>).
+type Argon2idHasher struct {
+	Time       uint32 // number of passes over memory
+	Memory     uint32 // memory used in KiB
+	Threads    uint8  // degree of parallelism
+	KeyLength  uint32 // length of the derived key in bytes
+	SaltLength uint32 // length of the random salt in bytes
+}
+
+// argon2idParams holds the parameters decoded from an argon2id hash.
+type argon2idParams struct {
+	version int
+	hasher  Argon2idHasher
+	salt    []byte
+	key     []byte
+}
+
+// decode parses an argon2id hash in the PHC string format.
+func (hasher *Argon2idHasher) decode(hash []byte) (*argon2idParams, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.hasher.Memory, &params.hasher.Time,
+		&params.hasher.Threads); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	params.hasher.SaltLength = uint32(len(params.salt))
+	params.hasher.KeyLength = uint32(len(params.key))
+
+	return params, nil
+}
+
+// Hash implements Hasher.Hash for Argon2idHasher.
+func (hasher *Argon2idHasher) Hash(password []byte) ([]byte, error) {
+	salt := make([]byte, hasher.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey(password, salt, hasher.Time, hasher.Memory, hasher.Threads, hasher.KeyLength)
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, hasher.Memory, hasher.Time,
+		hasher.Threads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// Compare implements Hasher.Compare for Argon2idHasher.
+func (hasher *Argon2idHasher) Compare(hash, password []byte) error {
+	params, err := hasher.decode(hash)
+	if err != nil {
+		return err
+	}
+	if params.version != argon2.Version {
+		return fmt.Errorf("models: unsupported argon2 version %d", params.version)
+	}
+
+	key := argon2.IDKey(password, params.salt, params.hasher.Time, params.hasher.Memory, params.hasher.Threads,
+		params.hasher.KeyLength)
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+// Handles implements Hasher.Handles for Argon2idHasher.
+func (hasher *Argon2idHasher) Handles(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$argon2id$"))
+}
+
+// NeedsRehash implements Hasher.NeedsRehash for Argon2idHasher.
+func (hasher *Argon2idHasher) NeedsRehash(hash []byte) bool {
+	params, err := hasher.decode(hash)
+	return err != nil || params.version != argon2.Version || params.hasher != *hasher
+}
+
+var hashers map[string]Hasher
+var configuredHasher Hasher
+var oneHasher sync.Once
+
+// loadHashers creates an instance of every supported Hasher using the
+// parameters in the configuration file. If the configured algorithm is not
+// supported panic is called.
+func loadHashers() {
+	oneHasher.Do(func() {
+		config := core.GetConfig()
+
+		argon2id := &Argon2idHasher{
+			Time:       config.Hasher.Argon2id.Time,
+			Memory:     config.Hasher.Argon2id.Memory,
+			Threads:    config.Hasher.Argon2id.Threads,
+			KeyLength:  32,
+			SaltLength: 16,
+		}
+		if argon2id.Time == 0 {
+			argon2id.Time = 3
+		}
+		if argon2id.Memory == 0 {
+			argon2id.Memory = 64 * 1024
+		}
+		if argon2id.Threads == 0 {
+			argon2id.Threads = 2
+		}
+
+		hashers = map[string]Hasher{
+			"bcrypt":   &BcryptHasher{Cost: config.HashCost},
+			"argon2id": argon2id,
+		}
+
+		algorithm := config.Hasher.Algorithm
+		if algorithm == "" {
+			algorithm = "bcrypt"
+		}
+
+		var ok bool
+		if configuredHasher, ok = hashers[algorithm]; !ok {
+			log.Panicf("GetHasher: unsupported password hashing algorithm '%s'", algorithm)
+		}
+	})
+}
+
+// GetHasher returns the Hasher selected in the configuration file, which is
+// used to hash all new passwords.
+func GetHasher() Hasher {
+	loadHashers()
+	return configuredHasher
+}
+
+// hasherFor returns the Hasher able to verify a hash or nil if the algorithm
+// that produced the hash is not supported.
+func hasherFor(hash []byte) Hasher {
+	loadHashers()
+	if configuredHasher.Handles(hash) {
+		return configuredHasher
+	}
+
+	for _, hasher := range hashers {
+		if hasher.Handles(hash) {
+			return hasher
+		}
+	}
+
+	return nil
+}
+
+// compareHash compares a plaintext password with a hash produced by any
+// supported Hasher. Returns nil on success or an error on failure.
+func compareHash(hash []byte, password string) error {
+	hasher := hasherFor(hash)
+	if hasher == nil {
+		return ErrUnknownHash
+	}
+
+	return hasher.Compare(hash, []byte(password))
+}
+
+// outdatedHash returns true if the hash was not produced by the configured
+// Hasher with its current parameters.
+func outdatedHash(hash []byte) bool {
+	hasher := GetHasher()
+	return !hasher.Handles(hash) || hasher.NeedsRehash(hash)
+}
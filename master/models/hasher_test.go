@@ -0,0 +1,52 @@
+package models
+
+import "testing"
+
+// TestHashers ensures that each Hasher verifies its own hashes, recognizes
+// which hashes it produced and detects outdated parameters.
+func TestHashers(t *testing.T) {
+	bcryptHasher := &BcryptHasher{Cost: 4}
+	argon2idHasher := &Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLength: 32, SaltLength: 16}
+
+	for name, hasher := range map[string]Hasher{"BcryptHasher": bcryptHasher, "Argon2idHasher": argon2idHasher} {
+		hash, err := hasher.Hash([]byte(testPassword))
+		if err != nil {
+			t.Errorf("%s.Hash: got error:\n%s", name, err)
+			continue
+		}
+
+		if err := hasher.Compare(hash, []byte(testPassword)); err != nil {
+			t.Errorf("%s.Compare: got error:\n%s", name, err)
+		}
+		if err := hasher.Compare(hash, []byte(testPassword+"_")); err == nil {
+			t.Errorf("%s.Compare: expected error with wrong password", name)
+		}
+		if !hasher.Handles(hash) {
+			t.Errorf("%s.Handles: expected true with own hash", name)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("%s.NeedsRehash: expected false with own hash", name)
+		}
+	}
+
+	hash, _ := bcryptHasher.Hash([]byte(testPassword))
+	if argon2idHasher.Handles(hash) {
+		t.Error("Argon2idHasher.Handles: expected false with bcrypt hash")
+	}
+	if !(&BcryptHasher{Cost: 5}).NeedsRehash(hash) {
+		t.Error("BcryptHasher.NeedsRehash: expected true with different cost")
+	}
+
+	hash, _ = (&BcryptHasher{}).Hash([]byte(testPassword))
+	if (&BcryptHasher{}).NeedsRehash(hash) {
+		t.Error("BcryptHasher.NeedsRehash: expected false with own hash when cost is unset")
+	}
+
+	hash, _ = argon2idHasher.Hash([]byte(testPassword))
+	if bcryptHasher.Handles(hash) {
+		t.Error("BcryptHasher.Handles: expected false with argon2id hash")
+	}
+	if !(&Argon2idHasher{Time: 2, Memory: 1024, Threads: 1, KeyLength: 32, SaltLength: 16}).NeedsRehash(hash) {
+		t.Error("Argon2idHasher.NeedsRehash: expected true with different parameters")
+	}
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jmoiron/sqlx"
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/shared"
+)
+
+const (
+	defaultInviteExpireAfter = 72 // hours before invitations expire if not configured
+
+	// inviteAudience is the audience of invitation tokens. Tokens signed for
+	// signing in use a different audience, so that although they share a
+	// secret neither is accepted in place of the other.
+	inviteAudience = "invite"
+)
+
+// Invite allows the owner of an email address to create their own account.
+type Invite struct {
+	ID        uint64
+	Created   time.Time
+	Expires   time.Time
+	Accepted  *time.Time // nil until the invitation is used to create a user
+	Email     string
+	InvitedBy *uint64 // ID of the user who sent the invitation, nil if sent from the shell
+}
+
+// InviteClaims holds the JWT claims of an invitation link.
+type InviteClaims struct {
+	ID uint64 `json:"invite"`
+	jwt.StandardClaims
+}
+
+// NewInvite takes an email and the user sending the invitation, which may be
+// nil, and returns a new unsaved Invite. If the email is invalid or belongs to
+// an existing user, an ErrInvalid is returned.
+func NewInvite(email string, invitedBy *User) (*Invite, error) {
+	lifetime := core.GetConfig().Invites.ExpireAfter
+	if lifetime <= 0 {
+		lifetime = defaultInviteExpireAfter
+	}
+
+	invite := &Invite{
+		Created: shared.Time(),
+		Expires: shared.Time().Add(time.Duration(lifetime) * time.Hour),
+		Email:   email,
+	}
+	if invitedBy != nil {
+		invite.InvitedBy = &invitedBy.ID
+	}
+
+	if err := invite.validate(); err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// GetInvite fetches an Invite from the database by ID. If no such invitation
+// exists an ErrNoEntry is returned.
+func GetInvite(id uint64) (*Invite, error) {
+	invite := &Invite{}
+	if err := core.GetDB().QueryRowx("SELECT * FROM invite WHERE ID=?", id).StructScan(invite); err == sql.ErrNoRows {
+		return nil, &ErrNoEntry{Type: "invite", Identifier: id}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// ParseInviteToken returns the Invite referenced by the token in an invitation
+// link. If the token is not valid, has expired or has already been used, an
+// ErrInvalid is returned.
+func ParseInviteToken(token string) (*Invite, error) {
+	invalid := &ErrInvalid{Model: "invite", Which: "token", Reason: "is not valid", Code: "invalid"}
+
+	claims := &InviteClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("jwt: invalid signing method")
+		}
+		return []byte(core.GetConfig().Secret), nil
+	})
+	if err != nil || !parsed.Valid || claims.Audience != inviteAudience {
+		return nil, invalid
+	}
+
+	invite, err := GetInvite(claims.ID)
+	if IsErrNoEntry(err) {
+		return nil, invalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	if invite.Accepted != nil {
+		return nil, &ErrInvalid{Model: "invite", Which: "token", Reason: "has already been used", Code: "used"}
+	} else if !shared.Time().Before(invite.Expires) {
+		return nil, &ErrInvalid{Model: "invite", Which: "token", Reason: "has expired", Code: "expired"}
+	}
+
+	return invite, nil
+}
+
+// validate ensures that the invitation is for a valid email address that does
+// not belong to an existing user.
+func (invite *Invite) validate() error {
+	if !ValidUserEmail.MatchString(invite.Email) {
+		return &ErrInvalid{Model: "invite", Which: "email", Value: invite.Email}
+	}
+
+	if _, err := GetAnyUser(invite.Email); err == nil {
+		return &ErrInvalid{Model: "invite", Which: "email", Value: invite.Email,
+			Reason: "belongs to an existing user", Code: "taken"}
+	} else if !IsErrNoEntry(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Save creates a new database entry for the invitation. Any earlier invitations
+// for the same email that have not been accepted stop working, unless saving
+// fails in which case they are kept.
+func (invite *Invite) Save() error {
+	tx, err := core.GetDB().Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := invite.insert(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insert removes pending invitations for the same email and creates a new
+// database entry for the invitation, recording its ID.
+func (invite *Invite) insert(db sqlx.Execer) error {
+	if _, err := db.Exec("DELETE FROM invite WHERE Email=? AND Accepted IS NULL", invite.Email); err != nil {
+		return err
+	}
+
+	res, err := db.Exec("INSERT INTO invite (Created, Expires, Email, InvitedBy) VALUES (?, ?, ?, ?)",
+		invite.Created, invite.Expires, invite.Email, invite.InvitedBy)
+	if err != nil {
+		return err
+	}
+
+	if insertID, err := res.LastInsertId(); err != nil {
+		panic(fmt.Sprint("Invite.insert: got error while fetching ID of inserted invite:\n", err))
+	} else {
+		invite.ID = uint64(insertID)
+	}
+
+	return nil
+}
+
+// Token returns the signed token identifying the invitation in links. The
+// token expires along with the invitation and is only accepted by
+// ParseInviteToken.
+func (invite *Invite) Token() (string, error) {
+	claims := &InviteClaims{
+		ID: invite.ID,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  inviteAudience,
+			ExpiresAt: invite.Expires.Unix(),
+			Subject:   invite.Email,
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(core.GetConfig().Secret))
+}
+
+// Link returns the address of the page where the invitation is accepted.
+func (invite *Invite) Link() (string, error) {
+	token, err := invite.Token()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(core.GetConfig().URL, "/") + "/invite/" + token, nil
+}
+
+// Send delivers the invitation link to the invited email address using the
+// configured Mailer.
+func (invite *Invite) Send() error {
+	link, err := invite.Link()
+	if err != nil {
+		return err
+	}
+
+	name := core.GetConfig().BrandName()
+	body := fmt.Sprintf("You have been invited to create an account on %s.\n\n"+
+		"Choose your name and password at the link below before %s:\n\n%s\n",
+		name, invite.Expires.Format("January 2, 2006 at 15:04 MST"), link)
+
+	return core.GetMailer().Send(invite.Email, fmt.Sprintf("Your %s invitation", name), body)
+}
+
+// Accept creates a user with the invited email and the name and password
+// provided, then marks the invitation as used. If the name or password is
+// invalid an ErrInvalid is returned. If the invitation was used in the
+// meantime an ErrBadEffect is returned and no user is created.
+func (invite *Invite) Accept(name, password string) (*User, error) {
+	user, err := NewUser(name, invite.Email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := core.GetDB().Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := shared.Time()
+	res, err := tx.Exec("UPDATE invite SET Accepted=? WHERE ID=? AND Accepted IS NULL", accepted, invite.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := ShouldAffect("Invite.Accept", res, 1); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := user.insert(tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	invite.Accepted = &accepted
+	return user, nil
+}
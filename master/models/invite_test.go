@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/octacian/extensus/master/core"
+)
+
+// TestInviteAccept ensures that an invitation token can be used exactly once to
+// create a user.
+func TestInviteAccept(t *testing.T) {
+	invite, err := NewInvite("jane@doe.me", nil)
+	if err != nil {
+		t.Fatal("NewInvite: got error:\n", err)
+	}
+	if err := invite.Save(); err != nil {
+		t.Fatal("Invite.Save: got error:\n", err)
+	}
+	defer core.GetDB().Exec("DELETE FROM invite WHERE ID=?", invite.ID)
+
+	token, err := invite.Token()
+	if err != nil {
+		t.Fatal("Invite.Token: got error:\n", err)
+	}
+
+	if _, err := ParseInviteToken(token + "x"); !IsErrInvalid(err) {
+		t.Errorf("ParseInviteToken: expected ErrInvalid for a tampered token, got: %v", err)
+	}
+
+	// A token signed with the same secret for another audience is rejected.
+	other, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &InviteClaims{ID: invite.ID,
+		StandardClaims: jwt.StandardClaims{Audience: "login", ExpiresAt: invite.Expires.Unix()}}).
+		SignedString([]byte(core.GetConfig().Secret))
+	if err != nil {
+		t.Fatal("jwt.SignedString: got error:\n", err)
+	}
+	if _, err := ParseInviteToken(other); !IsErrInvalid(err) {
+		t.Errorf("ParseInviteToken: expected ErrInvalid for a token with another audience, got: %v", err)
+	}
+
+	parsed, err := ParseInviteToken(token)
+	if err != nil {
+		t.Fatal("ParseInviteToken: got error:\n", err)
+	} else if parsed.ID != invite.ID {
+		t.Errorf("ParseInviteToken: got invite %d expected %d", parsed.ID, invite.ID)
+	}
+
+	if _, err := parsed.Accept("Jane Doe", "short"); !IsErrInvalid(err) {
+		t.Errorf("Invite.Accept: expected ErrInvalid for a weak password, got: %v", err)
+	}
+
+	user, err := parsed.Accept("Jane Doe", testPassword)
+	if err != nil {
+		t.Fatal("Invite.Accept: got error:\n", err)
+	}
+	defer user.Purge()
+
+	if user.Email != invite.Email {
+		t.Errorf("Invite.Accept: got email '%s' expected '%s'", user.Email, invite.Email)
+	}
+	if _, err := AuthenticateUser(invite.Email, testPassword); err != nil {
+		t.Error("AuthenticateUser: got error:\n", err)
+	}
+
+	if _, err := ParseInviteToken(token); !IsErrInvalid(err) {
+		t.Errorf("ParseInviteToken: expected ErrInvalid for a used token, got: %v", err)
+	}
+	if _, err := NewInvite(invite.Email, nil); !IsErrInvalid(err) {
+		t.Errorf("NewInvite: expected ErrInvalid for an existing user, got: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/octacian/extensus/master/i18n"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -63,11 +64,32 @@ func (err *ErrBadEffect) Error() string {
 		err.Affected, err.Expected)
 }
 
+// ErrConflict is returned when an entry could not be updated because it was
+// modified by someone else after it was loaded.
+type ErrConflict struct {
+	Type       string      // the type of the entry
+	Identifier interface{} // identifier used to find the entry, usually unique
+}
+
+// IsErrConflict returns true if the error is an ErrConflict.
+func IsErrConflict(err error) bool {
+	_, ok := err.(*ErrConflict)
+	return ok
+}
+
+// Error implements the error interface for ErrConflict.
+func (err *ErrConflict) Error() string {
+	return fmt.Sprintf("models: %s '%v' was modified after it was loaded", err.Type, err.Identifier)
+}
+
 // ErrInvalid is returned when a field of some model is invalid.
 type ErrInvalid struct {
-	Model string
-	Which string
-	Value string
+	Model  string
+	Which  string
+	Value  string
+	Reason string        // optional description of why the value is invalid
+	Code   string        // optional key identifying the reason in message catalogs
+	Args   []interface{} // arguments of the reason, such as a minimum length
 }
 
 // IsErrInvalid returns true if the error is an ErrInvalid.
@@ -78,18 +100,49 @@ func IsErrInvalid(err error) bool {
 
 // Error implements the error interface for ErrInvalid.
 func (err *ErrInvalid) Error() string {
+	if err.Reason != "" {
+		return fmt.Sprintf("%s: invalid %s: %s", err.Model, err.Which, err.Reason)
+	}
 	if err.Value == "" {
 		return fmt.Sprintf("%s: %s cannot be blank", err.Model, err.Which)
 	}
 	return fmt.Sprintf("%s: invalid %s '%s'", err.Model, err.Which, err.Value)
 }
 
+// Localize returns a description of the error for users of a locale, e.g.
+// "Password must be at least 8 characters". The message is looked up in the
+// catalog by field and code, falling back to the reason and then to generic
+// messages using the translated name of the field.
+func (err *ErrInvalid) Localize(locale *i18n.Locale) string {
+	if err.Code != "" {
+		if key := "invalid." + err.Which + "." + err.Code; locale.Has(key) {
+			return locale.T(key, err.Args...)
+		}
+	}
+
+	label := err.Which
+	if key := "field." + err.Which; locale.Has(key) {
+		label = locale.T(key)
+	}
+
+	switch {
+	case err.Reason != "":
+		return locale.T("invalid.reason", label, err.Reason)
+	case locale.Has("invalid." + err.Which):
+		return locale.T("invalid." + err.Which)
+	case err.Value == "":
+		return locale.T("invalid.blank", label)
+	default:
+		return locale.T("invalid.value", label)
+	}
+}
+
 // ShouldAffect takes an sql.Result and returns an error if the number of rows
 // affected is different from what was expected.
 func ShouldAffect(name string, res sql.Result, expected int64) error {
 	if affected, err := res.RowsAffected(); err != nil {
 		log.Panicf("%s: got error while fetching affected row count: %s", name, err)
-	} else if affected != 1 {
+	} else if affected != expected {
 		return &ErrBadEffect{Name: name, Affected: affected, Expected: expected}
 	}
 
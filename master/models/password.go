@@ -0,0 +1,219 @@
+package models
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPasswordMinLength = 8    // used if no minimum length is configured
+	defaultPasswordMaxLength = 1024 // used if no maximum length is configured
+	bcryptPasswordMaxLength  = 72   // bcrypt ignores anything past 72 bytes
+)
+
+// PasswordPolicy describes the requirements a plaintext password must meet.
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowPersonal bool
+	History          int
+	MaxAge           time.Duration
+	Breached         map[string]bool // lower case breached or common passwords
+}
+
+var passwordPolicy *PasswordPolicy
+var onePasswordPolicy sync.Once
+
+// GetPasswordPolicy returns the PasswordPolicy described by the configuration
+// file, loading the breached password list if one is configured. If the list
+// cannot be read panic is called.
+func GetPasswordPolicy() *PasswordPolicy {
+	onePasswordPolicy.Do(func() {
+		config := core.GetConfig().Password
+		passwordPolicy = &PasswordPolicy{
+			MinLength:        config.MinLength,
+			MaxLength:        config.MaxLength,
+			RequireUpper:     config.RequireUpper,
+			RequireLower:     config.RequireLower,
+			RequireDigit:     config.RequireDigit,
+			RequireSymbol:    config.RequireSymbol,
+			DisallowPersonal: config.DisallowPersonal,
+			History:          config.History,
+			MaxAge:           time.Duration(config.MaxAge) * 24 * time.Hour,
+		}
+
+		if passwordPolicy.MinLength <= 0 {
+			passwordPolicy.MinLength = defaultPasswordMinLength
+		}
+		if passwordPolicy.MaxLength <= 0 {
+			passwordPolicy.MaxLength = defaultPasswordMaxLength
+		}
+		if _, ok := GetHasher().(*BcryptHasher); ok && passwordPolicy.MaxLength > bcryptPasswordMaxLength {
+			passwordPolicy.MaxLength = bcryptPasswordMaxLength
+		}
+
+		if config.BreachedList != "" {
+			breached, err := readPasswordList(shared.Path(config.BreachedList))
+			if err != nil {
+				log.Panicf("GetPasswordPolicy: got error while reading %s: %s", config.BreachedList, err)
+			}
+			passwordPolicy.Breached = breached
+		}
+	})
+
+	return passwordPolicy
+}
+
+// readPasswordList reads a file containing one password per line, ignoring
+// blank lines and lines starting with '#'.
+func readPasswordList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && line[0] != '#' {
+			list[strings.ToLower(line)] = true
+		}
+	}
+
+	return list, scanner.Err()
+}
+
+// Check returns an ErrInvalid describing the first requirement the password
+// does not meet, or nil if it meets all of them. The name and email of the
+// user the password belongs to are used to reject personal passwords.
+func (policy *PasswordPolicy) Check(password, name, email string) error {
+	invalid := func(code, reason string, args ...interface{}) error {
+		return &ErrInvalid{Model: "user", Which: "password", Reason: fmt.Sprintf(reason, args...), Code: code,
+			Args: args}
+	}
+
+	if length := len([]rune(password)); length < policy.MinLength {
+		return invalid("tooShort", "must be at least %d characters", policy.MinLength)
+	}
+	if len(password) > policy.MaxLength {
+		return invalid("tooLong", "must be no longer than %d bytes", policy.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			upper = true
+		case unicode.IsLower(char):
+			lower = true
+		case unicode.IsDigit(char):
+			digit = true
+		case !unicode.IsLetter(char):
+			symbol = true
+		}
+	}
+
+	if policy.RequireUpper && !upper {
+		return invalid("noUpper", "must contain an upper case letter")
+	}
+	if policy.RequireLower && !lower {
+		return invalid("noLower", "must contain a lower case letter")
+	}
+	if policy.RequireDigit && !digit {
+		return invalid("noDigit", "must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		return invalid("noSymbol", "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if policy.DisallowPersonal {
+		personal := strings.Fields(strings.ToLower(name))
+		if email != "" {
+			email = strings.ToLower(email)
+			personal = append(personal, email, strings.SplitN(email, "@", 2)[0])
+		}
+
+		for _, part := range personal {
+			if len(part) >= 3 && strings.Contains(lowered, part) {
+				return invalid("personal", "must not contain your name or email")
+			}
+		}
+	}
+
+	if policy.Breached[lowered] {
+		return invalid("common", "is too common or has appeared in a data breach")
+	}
+
+	return nil
+}
+
+// checkPasswordHistory returns an ErrInvalid if the plaintext password matches
+// the user's current password or one of the previous passwords remembered by
+// the password policy.
+func (user *User) checkPasswordHistory(password string) error {
+	reused := &ErrInvalid{Model: "user", Which: "password", Reason: "has been used recently", Code: "reused"}
+	if user.Password != nil && compareHash(user.Password, password) == nil {
+		return reused
+	}
+
+	history := GetPasswordPolicy().History
+	if user.ID == 0 || history <= 0 {
+		return nil
+	}
+
+	hashes := [][]byte{}
+	if err := core.GetDB().Select(&hashes, "SELECT Password FROM password_history WHERE UserID=? ORDER BY ID DESC "+
+		"LIMIT ?", user.ID, history); err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if compareHash(hash, password) == nil {
+			return reused
+		}
+	}
+
+	return nil
+}
+
+// recordPasswordHistory stores a replaced password hash and forgets any hashes
+// older than those remembered by the password policy.
+func (user *User) recordPasswordHistory(hash []byte) error {
+	history := GetPasswordPolicy().History
+	if history <= 0 {
+		return nil
+	}
+
+	if _, err := core.GetDB().Exec("INSERT INTO password_history (UserID, Created, Password) VALUES (?, ?, ?)",
+		user.ID, shared.Time(), hash); err != nil {
+		return err
+	}
+
+	_, err := core.GetDB().Exec("DELETE FROM password_history WHERE UserID=? AND ID NOT IN (SELECT ID FROM "+
+		"(SELECT ID FROM password_history WHERE UserID=? ORDER BY ID DESC LIMIT ?) AS remembered)",
+		user.ID, user.ID, history)
+	return err
+}
+
+// PasswordExpired returns true if the password policy has a maximum age and
+// the user's password is older than it.
+func (user *User) PasswordExpired() bool {
+	maxAge := GetPasswordPolicy().MaxAge
+	return maxAge > 0 && shared.Time().Sub(user.PasswordChanged) > maxAge
+}
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+// TestPasswordPolicy ensures that PasswordPolicy.Check enforces each of the
+// configurable requirements.
+func TestPasswordPolicy(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:        10,
+		MaxLength:        20,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowPersonal: true,
+		Breached:         map[string]bool{"password1!a": true},
+	}
+
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{"Sh0rt!", false},
+		{"Th1s!s-Far-Too-Long-To-Be-Valid", false},
+		{"n0-upper-case!", false},
+		{"N0-LOWER-CASE!", false},
+		{"No-Digits-Here!", false},
+		{"N0Symbols1nHere", false},
+		{"Johnny-B-G00de", false},
+		{"My-Bestdoe-2019", false},
+		{"PASSWORD1!a", false},
+		{"C0rrect-H0rse!", true},
+	}
+
+	for _, test := range tests {
+		err := policy.Check(test.password, "Johnny Bravo", "bestdoe@example.com")
+		if test.valid && err != nil {
+			t.Errorf("PasswordPolicy.Check(\"%s\"): got error:\n%s", test.password, err)
+		} else if !test.valid {
+			if err == nil {
+				t.Errorf("PasswordPolicy.Check(\"%s\"): expected error", test.password)
+			} else if invalid, ok := err.(*ErrInvalid); !ok {
+				t.Errorf("PasswordPolicy.Check(\"%s\"): expected error of type ErrInvalid, got:\n%s", test.password, err)
+			} else if invalid.Which != "password" || invalid.Reason == "" {
+				t.Errorf("PasswordPolicy.Check(\"%s\"): expected password error with a reason, got:\n%s",
+					test.password, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/shared"
+)
+
+// UserTransferFormats lists the formats users can be imported from and
+// exported to.
+var UserTransferFormats = []string{"csv", "json"}
+
+// userCSVHeader is the header row of CSV files holding UserRecords.
+var userCSVHeader = []string{"name", "email", "roles", "password", "invite"}
+
+// UserRecord describes a user being imported or exported. Password holds an
+// already hashed password, never a plaintext one. If Invite is true the user
+// is invited to choose a password instead.
+type UserRecord struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	Password string   `json:"password,omitempty"`
+	Invite   bool     `json:"invite,omitempty"`
+}
+
+// ErrImport is returned when one or more records cannot be imported. Rows
+// maps the 1-based position of each rejected record to the reason it was
+// rejected, which is usually an ErrInvalid.
+type ErrImport struct {
+	Rows map[int]error
+}
+
+// IsErrImport returns true if the error is an ErrImport.
+func IsErrImport(err error) bool {
+	_, ok := err.(*ErrImport)
+	return ok
+}
+
+// Error implements the error interface for ErrImport.
+func (err *ErrImport) Error() string {
+	return fmt.Sprintf("models: %d records cannot be imported", len(err.Rows))
+}
+
+// ReadUserRecords reads UserRecords in one of the UserTransferFormats. If the
+// data is malformed an error is returned.
+func ReadUserRecords(reader io.Reader, format string) ([]UserRecord, error) {
+	switch format {
+	case "json":
+		records := []UserRecord{}
+		if err := json.NewDecoder(reader).Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	case "csv":
+		return readUserCSV(reader)
+	default:
+		return nil, fmt.Errorf("ReadUserRecords: unknown format '%s'", format)
+	}
+}
+
+// readUserCSV reads UserRecords from CSV. The first row must name the columns,
+// which may appear in any order. Only the name and email columns are required.
+func readUserCSV(reader io.Reader) ([]UserRecord, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("readUserCSV: missing header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("readUserCSV: missing column '%s'", required)
+		}
+	}
+
+	records := make([]UserRecord, len(rows)-1)
+	for i, row := range rows[1:] {
+		value := func(column string) string {
+			if index, ok := columns[column]; ok && index < len(row) {
+				return strings.TrimSpace(row[index])
+			}
+			return ""
+		}
+
+		records[i] = UserRecord{Name: value("name"), Email: value("email"), Password: value("password")}
+		if roles := value("roles"); roles != "" {
+			records[i].Roles = strings.Split(roles, ";")
+		}
+		if invite := value("invite"); invite != "" {
+			if records[i].Invite, err = strconv.ParseBool(invite); err != nil {
+				return nil, fmt.Errorf("readUserCSV: row %d: invalid invite value '%s'", i+1, invite)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// WriteUserRecords writes UserRecords in one of the UserTransferFormats such
+// that they can be read back by ReadUserRecords.
+func WriteUserRecords(writer io.Writer, format string, records []UserRecord) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "csv":
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write(userCSVHeader); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := csvWriter.Write([]string{record.Name, record.Email, strings.Join(record.Roles, ";"),
+				record.Password, strconv.FormatBool(record.Invite)}); err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	default:
+		return fmt.Errorf("WriteUserRecords: unknown format '%s'", format)
+	}
+}
+
+// ExportUsers returns a UserRecord for every user that has not been deleted,
+// including each user's hashed password.
+func ExportUsers() ([]UserRecord, error) {
+	users, err := ListUser()
+	if IsErrEmpty(err) {
+		return []UserRecord{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	records := make([]UserRecord, len(users))
+	for i, user := range users {
+		records[i] = UserRecord{Name: user.Name, Email: user.Email, Roles: []string{},
+			Password: string(user.Password)}
+	}
+
+	return records, nil
+}
+
+// UserImport holds the users and invitations created from imported records.
+type UserImport struct {
+	Users   []*User
+	Invites []*Invite
+}
+
+// newImportedUser converts a record into an unsaved User, or an unsaved Invite
+// if the record asks for the user to be invited. Invited users choose their
+// own name, so records asking for an invitation must not have one rather than
+// have it silently dropped. If the record is invalid or belongs to an existing
+// user an ErrInvalid is returned.
+func newImportedUser(record UserRecord) (*User, *Invite, error) {
+	if len(record.Roles) > 0 {
+		return nil, nil, &ErrInvalid{Model: "user", Which: "roles", Value: strings.Join(record.Roles, ";"),
+			Reason: "roles are not supported"}
+	}
+
+	if record.Invite {
+		if record.Password != "" {
+			return nil, nil, &ErrInvalid{Model: "user", Which: "password",
+				Reason: "cannot be given when inviting a user"}
+		}
+		if record.Name != "" {
+			return nil, nil, &ErrInvalid{Model: "user", Which: "name", Value: record.Name,
+				Reason: "cannot be given when inviting a user, who chooses their own"}
+		}
+
+		invite, err := NewInvite(record.Email, nil)
+		return nil, invite, err
+	}
+
+	user := &User{
+		Created:         shared.Time(),
+		Modified:        shared.Time(),
+		Name:            record.Name,
+		Email:           record.Email,
+		Password:        []byte(record.Password),
+		PasswordChanged: shared.Time(),
+		Timezone:        defaultTimezone,
+		DateFormat:      defaultDateFormat,
+		Theme:           DefaultTheme,
+	}
+
+	if err := user.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if record.Password == "" {
+		return nil, nil, &ErrInvalid{Model: "user", Which: "password",
+			Reason: "a hashed password or invite is required"}
+	} else if hasherFor(user.Password) == nil {
+		return nil, nil, &ErrInvalid{Model: "user", Which: "password",
+			Reason: "not a hash produced by a supported algorithm"}
+	}
+
+	if _, err := GetAnyUser(user.Email); err == nil {
+		return nil, nil, &ErrInvalid{Model: "user", Which: "email", Value: user.Email,
+			Reason: "belongs to an existing user", Code: "taken"}
+	} else if !IsErrNoEntry(err) {
+		return nil, nil, err
+	}
+
+	return user, nil, nil
+}
+
+// ValidateUserRecords checks that every record could be imported without
+// saving anything and returns the users and invitations that would be
+// created. If any record is invalid, duplicates another record or belongs to
+// an existing user, an ErrImport is returned. If anything else goes wrong it
+// is returned.
+func ValidateUserRecords(records []UserRecord) (*UserImport, error) {
+	result := &UserImport{}
+	rejected := make(map[int]error)
+	seen := make(map[string]int)
+
+	for i, record := range records {
+		email := strings.ToLower(record.Email)
+		if row, ok := seen[email]; ok {
+			rejected[i+1] = &ErrInvalid{Model: "user", Which: "email", Value: record.Email,
+				Reason: fmt.Sprintf("duplicates record %d", row)}
+			continue
+		}
+		seen[email] = i + 1
+
+		user, invite, err := newImportedUser(record)
+		if IsErrInvalid(err) {
+			rejected[i+1] = err
+		} else if err != nil {
+			return nil, err
+		} else if invite != nil {
+			result.Invites = append(result.Invites, invite)
+		} else {
+			result.Users = append(result.Users, user)
+		}
+	}
+
+	if len(rejected) > 0 {
+		return nil, &ErrImport{Rows: rejected}
+	}
+
+	return result, nil
+}
+
+// ImportUsers creates a user or invitation for every record. Either everything
+// is created or, if any record is rejected or saving fails, nothing is. The
+// invitations are not sent. The errors returned are the same as those of
+// ValidateUserRecords.
+func ImportUsers(records []UserRecord) (*UserImport, error) {
+	result, err := ValidateUserRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := core.GetDB().Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range result.Users {
+		if err := user.insert(tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	for _, invite := range result.Invites {
+		if err := invite.insert(tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// insert creates a new database entry for the user and records its ID.
+func (user *User) insert(db sqlx.Execer) error {
+	res, err := db.Exec("INSERT INTO user (Created, Modified, Name, Email, Password, PasswordChanged, "+
+		"Avatar, Timezone, DateFormat, Locale, Theme) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", user.Created,
+		user.Modified, user.Name, user.Email, user.Password, user.PasswordChanged, user.Avatar, user.Timezone,
+		user.DateFormat, user.Locale, user.Theme)
+	if err != nil {
+		return err
+	}
+
+	if insertID, err := res.LastInsertId(); err != nil {
+		panic(fmt.Sprint("User.insert: got error while fetching ID of inserted user:\n", err))
+	} else {
+		user.ID = uint64(insertID)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestUserRecords ensures that UserRecords written by WriteUserRecords can be
+// read back by ReadUserRecords in every format.
+func TestUserRecords(t *testing.T) {
+	records := []UserRecord{
+		{Name: "John Doe", Email: "john@doe.me", Roles: []string{"admin", "editor"}, Password: "$2a$10$hash"},
+		{Email: "jane@doe.me", Roles: []string{}, Invite: true},
+	}
+
+	for _, format := range UserTransferFormats {
+		var buffer bytes.Buffer
+		if err := WriteUserRecords(&buffer, format, records); err != nil {
+			t.Fatalf("WriteUserRecords(%s): got error:\n%s", format, err)
+		}
+
+		read, err := ReadUserRecords(&buffer, format)
+		if err != nil {
+			t.Fatalf("ReadUserRecords(%s): got error:\n%s", format, err)
+		}
+
+		// CSV cannot tell an empty list of roles from no roles.
+		read[1].Roles = []string{}
+		if !reflect.DeepEqual(read, records) {
+			t.Errorf("ReadUserRecords(%s): expected %+v, got %+v", format, records, read)
+		}
+	}
+}
+
+// TestImportInviteName ensures that records asking for an invitation are
+// rejected if they have a name, which would otherwise be lost.
+func TestImportInviteName(t *testing.T) {
+	_, _, err := newImportedUser(UserRecord{Name: "Jane Doe", Email: "jane@doe.me", Invite: true})
+	if invalid, ok := err.(*ErrInvalid); !ok || invalid.Which != "name" {
+		t.Error("newImportedUser: expected ErrInvalid for name of invited user, got:", err)
+	}
+}
+
+// TestReadUserCSV ensures that CSV columns may appear in any order and that
+// malformed files are rejected.
+func TestReadUserCSV(t *testing.T) {
+	read, err := ReadUserRecords(strings.NewReader("Email,Name\njohn@doe.me,John Doe\n"), "csv")
+	if err != nil {
+		t.Fatal("ReadUserRecords: got error:\n", err)
+	}
+
+	expected := []UserRecord{{Name: "John Doe", Email: "john@doe.me"}}
+	if !reflect.DeepEqual(read, expected) {
+		t.Errorf("ReadUserRecords: expected %+v, got %+v", expected, read)
+	}
+
+	for _, data := range []string{"", "name\nJohn Doe\n", "name,email,invite\nJohn Doe,john@doe.me,maybe\n"} {
+		if _, err := ReadUserRecords(strings.NewReader(data), "csv"); err == nil {
+			t.Errorf("ReadUserRecords(%q): expected error", data)
+		}
+	}
+}
@@ -4,14 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/i18n"
 	"github.com/octacian/extensus/shared"
-	"golang.org/x/crypto/bcrypt"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
@@ -21,10 +23,29 @@ var (
 	// ValidUserEmail is regex to check if a user's email is valid.
 	ValidUserEmail = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
-	// ValidUserPassword is regex to check if a user's password is valid.
-	ValidUserPassword = regexp.MustCompile("^.{8,}$")
+	// DateFormats maps the date format names a user may choose from to layouts
+	// as understood by time.Time.Format.
+	DateFormats = map[string]string{
+		"iso":  "2006-01-02 15:04",
+		"us":   "01/02/2006 3:04 PM",
+		"eu":   "02/01/2006 15:04",
+		"long": "January 2, 2006 at 3:04 PM",
+	}
+
+	// Themes lists the color themes a user may choose from. The system theme
+	// follows the light or dark preference of the user's operating system.
+	Themes = []string{"system", "light", "dark"}
+)
+
+const (
+	defaultTimezone   = "UTC" // timezone assigned to new users
+	defaultDateFormat = "iso" // date format assigned to new users
 )
 
+// DefaultTheme is the theme assigned to new users and shown to visitors who are
+// not logged in.
+const DefaultTheme = "system"
+
 // userContextKey is the key for User values in Contexts. Clients must use
 // User.NewContext and models.UserFromContext.
 var userContextKey contextKey
@@ -34,10 +55,22 @@ type User struct {
 	ID       uint64
 	Created  time.Time
 	Modified time.Time
-
-	Name     string
-	Email    string
-	Password []byte
+	Deleted  *time.Time // nil unless the user has been soft-deleted
+
+	Name            string
+	Email           string
+	Password        []byte
+	PasswordChanged time.Time
+
+	Avatar     string // file name of the avatar thumbnail, empty if none
+	Timezone   string // IANA timezone name used when displaying times
+	DateFormat string // key of DateFormats used when displaying times
+	Locale     string // tag of the locale the web interface is shown in, empty to follow the browser
+	Theme      string // one of Themes
+
+	replacedAvatar   string // avatar file to remove once a new one is saved
+	unsavedAvatar    string // avatar file stored by SetAvatar but not yet saved
+	replacedPassword []byte // password hash to remember once a new one is saved
 }
 
 // NewUser takes a name, email, and plaintext password and returns a new User.
@@ -45,10 +78,13 @@ type User struct {
 // of the provided fields fails, an ErrInvalid is returned.
 func NewUser(name, email, password string) (*User, error) {
 	user := &User{
-		Created:  shared.Time(),
-		Modified: shared.Time(),
-		Name:     name,
-		Email:    email,
+		Created:    shared.Time(),
+		Modified:   shared.Time(),
+		Name:       name,
+		Email:      email,
+		Timezone:   defaultTimezone,
+		DateFormat: defaultDateFormat,
+		Theme:      DefaultTheme,
 	}
 
 	if err := user.validate(); err != nil {
@@ -62,11 +98,12 @@ func NewUser(name, email, password string) (*User, error) {
 	return user, nil
 }
 
-// ListUser returns an array of all Users in the database. If the user table is
-// empty an ErrEmpty is returned. If anything else goes wrong it is returned.
+// ListUser returns an array of all Users in the database that have not been
+// deleted. If no such users exist an ErrEmpty is returned. If anything else goes
+// wrong it is returned.
 func ListUser() ([]User, error) {
 	users := []User{}
-	err := core.GetDB().Select(&users, "SELECT * FROM user")
+	err := core.GetDB().Select(&users, "SELECT * FROM user WHERE Deleted IS NULL")
 	if len(users) == 0 {
 		return nil, &ErrEmpty{"user"}
 	}
@@ -74,18 +111,48 @@ func ListUser() ([]User, error) {
 	return users, err
 }
 
-// GetUser fetches a User from the database by email or by ID. If no such user
-// exists or something other than a string or integer is passed to GetUser, an
-// error is returned.
+// ListDeletedUser returns an array of all Users in the database that have been
+// soft-deleted. If no such users exist an ErrEmpty is returned. If anything
+// else goes wrong it is returned.
+func ListDeletedUser() ([]User, error) {
+	users := []User{}
+	err := core.GetDB().Select(&users, "SELECT * FROM user WHERE Deleted IS NOT NULL")
+	if len(users) == 0 {
+		return nil, &ErrEmpty{"user"}
+	}
+
+	return users, err
+}
+
+// GetUser fetches a User from the database by email or by ID. Deleted users are
+// ignored. If no such user exists or something other than a string or integer
+// is passed to GetUser, an error is returned.
 func GetUser(emailOrID interface{}) (*User, error) {
+	return getUser(emailOrID, false)
+}
+
+// GetAnyUser does the same as GetUser but also returns users that have been
+// soft-deleted.
+func GetAnyUser(emailOrID interface{}) (*User, error) {
+	return getUser(emailOrID, true)
+}
+
+// getUser fetches a User from the database by email or by ID, including
+// deleted users only if withDeleted is true.
+func getUser(emailOrID interface{}, withDeleted bool) (*User, error) {
 	var row *sqlx.Row
 	user := &User{}
 
+	filter := " AND Deleted IS NULL"
+	if withDeleted {
+		filter = ""
+	}
+
 	switch emailOrID.(type) {
 	case string:
-		row = core.GetDB().QueryRowx("SELECT * FROM user WHERE Email=?", emailOrID.(string))
+		row = core.GetDB().QueryRowx("SELECT * FROM user WHERE Email=?"+filter, emailOrID.(string))
 	case int:
-		row = core.GetDB().QueryRowx("SELECT * FROM user WHERE ID = ?", emailOrID.(int))
+		row = core.GetDB().QueryRowx("SELECT * FROM user WHERE ID = ?"+filter, emailOrID.(int))
 	default:
 		return nil, errors.New("Expected emailOrID argument to be of type string or int")
 	}
@@ -99,8 +166,41 @@ func GetUser(emailOrID interface{}) (*User, error) {
 	return user, nil
 }
 
+// PurgeDeletedUsers permanently removes all users that were soft-deleted
+// before the time provided and returns the number of users removed.
+func PurgeDeletedUsers(before time.Time) (int64, error) {
+	users := []User{}
+	if err := core.GetDB().Select(&users, "SELECT * FROM user WHERE Deleted IS NOT NULL AND Deleted < ?",
+		before); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for i := range users {
+		if err := users[i].Purge(); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// PurgeExpiredUsers permanently removes all users that have been deleted for
+// longer than the purge period set in the configuration file. If the purge
+// period is not greater than zero nothing is removed.
+func PurgeExpiredUsers() (int64, error) {
+	days := core.GetConfig().PurgeAfter
+	if days <= 0 {
+		return 0, nil
+	}
+
+	return PurgeDeletedUsers(shared.Time().AddDate(0, 0, -days))
+}
+
 // AuthenticateUser takes an email and a plaintext password and returns the
-// matching user. If no matching user exists, an ErrNoEntry is returned.
+// matching user. If no matching user exists or the user has been deleted, an
+// ErrNoEntry is returned.
 func AuthenticateUser(email, password string) (*User, error) {
 	user, err := GetUser(email)
 	if err != nil {
@@ -125,8 +225,8 @@ func (user *User) NewContext(parent context.Context) context.Context {
 	return context.WithValue(parent, userContextKey, user)
 }
 
-// validate ensures that the user's name and email are valid and returns an
-// ErrInvalid if anything is wrong.
+// validate ensures that the user's name, email and preferences are valid and
+// returns an ErrInvalid if anything is wrong.
 func (user *User) validate() error {
 	if !ValidUserName.MatchString(user.Name) {
 		return &ErrInvalid{Model: "user", Which: "name", Value: user.Name}
@@ -136,53 +236,182 @@ func (user *User) validate() error {
 		return &ErrInvalid{Model: "user", Which: "email", Value: user.Email}
 	}
 
+	if _, err := time.LoadLocation(user.Timezone); err != nil || user.Timezone == "" {
+		return &ErrInvalid{Model: "user", Which: "timezone", Value: user.Timezone}
+	}
+
+	if _, ok := DateFormats[user.DateFormat]; !ok {
+		return &ErrInvalid{Model: "user", Which: "dateFormat", Value: user.DateFormat}
+	}
+
+	if _, ok := i18n.Get(user.Locale); !ok && user.Locale != "" {
+		return &ErrInvalid{Model: "user", Which: "locale", Value: user.Locale}
+	}
+
+	if !validTheme(user.Theme) {
+		return &ErrInvalid{Model: "user", Which: "theme", Value: user.Theme}
+	}
+
 	return nil
 }
 
+// validTheme returns true if the theme is one of Themes.
+func validTheme(theme string) bool {
+	for _, known := range Themes {
+		if theme == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Location returns the time.Location matching the user's timezone preference,
+// falling back to UTC if it cannot be loaded.
+func (user *User) Location() *time.Location {
+	if location, err := time.LoadLocation(user.Timezone); err == nil {
+		return location
+	}
+
+	return time.UTC
+}
+
+// DateLayout returns the time.Time.Format layout matching the user's date
+// format preference, falling back to the default format if it is unknown.
+func (user *User) DateLayout() string {
+	if layout, ok := DateFormats[user.DateFormat]; ok {
+		return layout
+	}
+
+	return DateFormats[defaultDateFormat]
+}
+
 // Save propagates any changes back to the database. If the ID field is 0, a
 // new entry is created. Otherwise, Save attempts to update an existing entry.
 // If anything goes wrong an error is returned. If the user's name or email is
-// invalid, an ErrInvalid is returned.
+// invalid, an ErrInvalid is returned. If the entry was modified by someone else
+// since the user was loaded, an ErrConflict is returned and nothing is changed.
+// If the entry cannot be written any avatar stored since the user was last
+// saved is removed.
 func (user *User) Save() error {
-	if err := user.validate(); err != nil {
+	inserted := user.ID == 0
+	if err := user.write(); err != nil {
+		user.discardAvatar()
 		return err
 	}
+	user.unsavedAvatar = ""
 
-	if user.ID == 0 {
-		res, err := core.GetDB().Exec("INSERT INTO user (Created, Modified, Name, Email, Password) VALUES (?, ?, ?, ?, ?)",
-			user.Created, user.Modified, user.Name, user.Email, user.Password)
-		if err != nil {
+	if user.replacedPassword != nil && !inserted {
+		if err := user.recordPasswordHistory(user.replacedPassword); err != nil {
 			return err
 		}
+	}
+	user.replacedPassword = nil
 
-		if insertID, err := res.LastInsertId(); err != nil {
-			panic(fmt.Sprint("User.Save: got error while fetching ID of inserted user:\n", err))
-		} else {
-			user.ID = uint64(insertID)
-		}
-	} else {
-		user.Modified = shared.Time()
-		res, err := core.GetDB().Exec("UPDATE user SET Modified=?, Name=?, Email=?, Password=? WHERE Email=?",
-			user.Modified, user.Name, user.Email, user.Password, user.Email)
-		if err != nil {
+	if user.replacedAvatar != "" && user.replacedAvatar != user.Avatar {
+		if err := os.Remove(filepath.Join(AvatarDirectory(), user.replacedAvatar)); err != nil && !os.IsNotExist(err) {
 			return err
 		}
+	}
+	user.replacedAvatar = ""
 
-		return ShouldAffect("User.Save", res, 1)
+	return nil
+}
+
+// write validates the user and inserts or updates its entry.
+func (user *User) write() error {
+	if err := user.validate(); err != nil {
+		return err
+	}
+
+	if user.ID == 0 {
+		return user.insert(core.GetDB())
+	}
+
+	// The modified time doubles as a version number, so it must change with
+	// every update even if two saves happen within the same millisecond.
+	previous := user.Modified
+	modified := shared.Time()
+	if !modified.After(previous) {
+		modified = previous.Add(time.Millisecond)
+	}
+
+	res, err := core.GetDB().Exec("UPDATE user SET Modified=?, Name=?, Email=?, Password=?, PasswordChanged=?, "+
+		"Avatar=?, Timezone=?, DateFormat=?, Locale=?, Theme=? WHERE ID=? AND Modified=?", modified, user.Name,
+		user.Email, user.Password, user.PasswordChanged, user.Avatar, user.Timezone, user.DateFormat, user.Locale,
+		user.Theme, user.ID, previous)
+	if err != nil {
+		return err
+	}
+
+	if err := ShouldAffect("User.Save", res, 1); err != nil {
+		if _, err := GetAnyUser(int(user.ID)); err != nil {
+			return err
+		}
+		return &ErrConflict{Type: "user", Identifier: user.ID}
 	}
 
+	user.Modified = modified
+	Uncache(int(user.ID))
 	return nil
 }
 
-// Delete removes the user from the database. If the ID field is 0 an
-// ErrNoEntry is returned. If any other errors occurs it is returned.
+// Delete soft-deletes the user by recording the time of deletion. Deleted
+// users are ignored by GetUser, ListUser and AuthenticateUser until they are
+// restored. If the user is unsaved or already deleted an ErrBadEffect is
+// returned. If any other errors occurs it is returned.
 func (user *User) Delete() error {
-	res, err := core.GetDB().Exec("DELETE FROM user WHERE Email=?", user.Email)
+	deleted := shared.Time()
+	res, err := core.GetDB().Exec("UPDATE user SET Deleted=? WHERE ID=? AND Deleted IS NULL", deleted, user.ID)
 	if err != nil {
 		return err
 	}
 
-	return ShouldAffect("User.Delete", res, 1)
+	if err := ShouldAffect("User.Delete", res, 1); err != nil {
+		return err
+	}
+
+	user.Deleted = &deleted
+	Uncache(int(user.ID))
+	return nil
+}
+
+// Restore reverses a soft-delete. If the user is not deleted an ErrBadEffect is
+// returned. If any other error occurs it is returned.
+func (user *User) Restore() error {
+	res, err := core.GetDB().Exec("UPDATE user SET Deleted=NULL WHERE ID=? AND Deleted IS NOT NULL", user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := ShouldAffect("User.Restore", res, 1); err != nil {
+		return err
+	}
+
+	user.Deleted = nil
+	return nil
+}
+
+// Purge permanently removes the user and its avatar whether or not it has been
+// soft-deleted. If the user does not exist an ErrBadEffect is returned. If any
+// other error occurs it is returned.
+func (user *User) Purge() error {
+	res, err := core.GetDB().Exec("DELETE FROM user WHERE ID=?", user.ID)
+	if err != nil {
+		return err
+	}
+
+	Uncache(int(user.ID))
+	if err := ShouldAffect("User.Purge", res, 1); err != nil {
+		return err
+	}
+
+	return user.removeAvatar()
+}
+
+// IsDeleted returns true if the user has been soft-deleted.
+func (user *User) IsDeleted() bool {
+	return user.Deleted != nil
 }
 
 // Refresh updates the user object to be equivalent to the corresponding
@@ -200,24 +429,62 @@ func (user *User) Refresh(identifier interface{}) error {
 
 // SetPassword takes a plaintext password and hashes it before storing it in
 // the password field. If the plaintext password does not meet the requirements
-// an ErrInvalid is returned. If an error occurs while hashing the password, it
-// is returned.
+// of the password policy or has been used recently, an ErrInvalid describing
+// the reason is returned. If an error occurs while hashing the password, it is
+// returned.
 func (user *User) SetPassword(password string) error {
-	if !ValidUserPassword.MatchString(password) {
-		return &ErrInvalid{Model: "user", Which: "password", Value: string(user.Password)}
+	if err := GetPasswordPolicy().Check(password, user.Name, user.Email); err != nil {
+		return err
+	}
+
+	if err := user.checkPasswordHistory(password); err != nil {
+		return err
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), core.GetConfig().HashCost)
+	hash, err := GetHasher().Hash([]byte(password))
 	if err != nil {
 		return err
 	}
 
+	if user.replacedPassword == nil {
+		user.replacedPassword = user.Password
+	}
 	user.Password = hash
+	user.PasswordChanged = shared.Time()
 	return nil
 }
 
 // Authenticate takes a plaintext password and compares it with the hashed
-// password stored. Returns nil on succcess or an error on failure.
+// password stored. Returns nil on succcess or an error on failure. If the
+// stored hash was not produced by the configured Hasher with its current
+// parameters, the password is rehashed and, if the user is saved, the new hash
+// is written to the database.
 func (user *User) Authenticate(password string) error {
-	return bcrypt.CompareHashAndPassword(user.Password, []byte(password))
+	if err := compareHash(user.Password, password); err != nil {
+		return err
+	}
+
+	if !outdatedHash(user.Password) {
+		return nil
+	}
+
+	hash, err := GetHasher().Hash([]byte(password))
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error()}).Warn("User.Authenticate: failed to rehash outdated password")
+		return nil
+	}
+
+	// Only the password is written so that the upgrade does not conflict with
+	// anyone editing the user at the same time.
+	if user.ID != 0 {
+		if _, err := core.GetDB().Exec("UPDATE user SET Password=? WHERE ID=? AND Password=?", hash, user.ID,
+			user.Password); err != nil {
+			log.WithFields(log.Fields{"error": err.Error()}).Warn("User.Authenticate: failed to store rehashed password")
+			return nil
+		}
+		Uncache(int(user.ID))
+	}
+
+	user.Password = hash
+	return nil
 }
@@ -2,13 +2,22 @@ package models
 
 import (
 	"context"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/octacian/extensus/shared"
 )
 
 var testPassword = "!test?9@_*"
 
+// TestMain reads config.json from the root of the source tree rather than the
+// directory of the package.
+func TestMain(m *testing.M) {
+	shared.SetRootDirectory(shared.Abs("."))
+	os.Exit(m.Run())
+}
+
 // WithUser executes a closure providing it with a valid, generic user.
 func WithUser(t *testing.T, fn func(*User)) {
 	if user, err := NewUser("John Doe", "john@doe.me", testPassword); err != nil {
@@ -78,8 +87,41 @@ func TestUserAuth(t *testing.T) {
 			}
 		}
 
-		if err := user.Delete(); err != nil {
-			t.Fatal("User.Delete: got error:\n", err)
+		if err := user.Purge(); err != nil {
+			t.Fatal("User.Purge: got error:\n", err)
+		}
+	})
+}
+
+// TestUserRehash ensures that logging in with a password hashed by an outdated
+// Hasher stores a new hash produced by the configured Hasher.
+func TestUserRehash(t *testing.T) {
+	loadHashers()
+	previous := configuredHasher
+	configuredHasher = hashers["argon2id"]
+	defer func() { configuredHasher = previous }()
+
+	WithUser(t, func(user *User) {
+		legacy, err := (&BcryptHasher{Cost: 4}).Hash([]byte(testPassword))
+		if err != nil {
+			t.Fatal("BcryptHasher.Hash: got error:\n", err)
+		}
+		user.Password = legacy
+		if err := user.Save(); err != nil {
+			t.Fatal("User.Save: got error:\n", err)
+		}
+		defer user.Purge()
+
+		if _, err := AuthenticateUser(user.Email, testPassword); err != nil {
+			t.Fatal("AuthenticateUser: got error:\n", err)
+		}
+
+		if got, err := GetUser(int(user.ID)); err != nil {
+			t.Error("GetUser: got error:\n", err)
+		} else if !hashers["argon2id"].Handles(got.Password) {
+			t.Errorf("AuthenticateUser: expected stored hash to become argon2id, got '%s'", got.Password)
+		} else if err := compareHash(got.Password, testPassword); err != nil {
+			t.Error("compareHash: got error with rehashed password:\n", err)
 		}
 	})
 }
@@ -110,6 +152,15 @@ func TestValidation(t *testing.T) {
 		err = user.SetPassword("bad")
 		expectInvalid("User.SetPassword", "password", err)
 	})
+
+	WithUser(t, func(user *User) {
+		user.Timezone = "Mars/Olympus_Mons"
+		expectInvalid("User.Save", "timezone", user.Save())
+
+		user.Timezone = "America/New_York"
+		user.DateFormat = "stardate"
+		expectInvalid("User.Save", "dateFormat", user.Save())
+	})
 }
 
 // TestListUser ensures that ListUser returns expected results.
@@ -132,8 +183,8 @@ func TestListUser(t *testing.T) {
 				t.Errorf("ListUser[0].Name: got '%s' expected '%s'", users[0].Name, user.Name)
 			}
 
-			if err := user.Delete(); err != nil {
-				t.Fatal("User.Delete: got error:\n", err)
+			if err := user.Purge(); err != nil {
+				t.Fatal("User.Purge: got error:\n", err)
 			}
 		}
 	})
@@ -208,5 +259,119 @@ func TestUserCRUD(t *testing.T) {
 		} else if _, ok := err.(*ErrNoEntry); !ok {
 			t.Error("GetUser: expected error of type ErrNoEntry")
 		}
+
+		if err := user.Purge(); err != nil {
+			t.Error("User.Purge: got error:\n", err)
+		}
+	})
+}
+
+// TestUserConflict ensures that concurrent edits to the same user are detected
+// and that changing a user's email does not prevent it from being saved.
+func TestUserConflict(t *testing.T) {
+	WithUser(t, func(user *User) {
+		if err := user.Save(); err != nil {
+			t.Fatal("User.Save: got error:\n", err)
+		}
+
+		user.Email = "johnathan@doe.me"
+		if err := user.Save(); err != nil {
+			t.Error("User.Save: got error after changing email:\n", err)
+		}
+
+		other, err := GetUser(int(user.ID))
+		if err != nil {
+			t.Fatal("GetUser: got error:\n", err)
+		}
+
+		user.Name = "Johnathan Doe"
+		if err := user.Save(); err != nil {
+			t.Error("User.Save: got error:\n", err)
+		}
+
+		other.Name = "Jane Doe"
+		if err := other.Save(); err == nil {
+			t.Error("User.Save: expected error with stale user")
+		} else if _, ok := err.(*ErrConflict); !ok {
+			t.Error("User.Save: expected error of type ErrConflict, got:\n", err)
+		}
+
+		if got, err := GetUser(int(user.ID)); err != nil {
+			t.Error("GetUser: got error:\n", err)
+		} else if got.Name != user.Name {
+			t.Errorf("GetUser.Name: got '%s' expected '%s'", got.Name, user.Name)
+		}
+
+		if err := user.Purge(); err != nil {
+			t.Error("User.Purge: got error:\n", err)
+		}
+	})
+}
+
+// TestUserSoftDelete ensures that deleted users are hidden until they are
+// restored and that purging removes them permanently.
+func TestUserSoftDelete(t *testing.T) {
+	WithUser(t, func(user *User) {
+		if err := user.Save(); err != nil {
+			t.Fatal("User.Save: got error:\n", err)
+		}
+
+		if err := user.Delete(); err != nil {
+			t.Fatal("User.Delete: got error:\n", err)
+		} else if !user.IsDeleted() {
+			t.Error("User.IsDeleted: expected true after User.Delete")
+		}
+
+		if err := user.Delete(); err == nil {
+			t.Error("User.Delete: expected error with deleted user")
+		} else if _, ok := err.(*ErrBadEffect); !ok {
+			t.Error("User.Delete: expected error of type ErrBadEffect, got:\n", err)
+		}
+
+		if _, err := ListUser(); err == nil {
+			t.Error("ListUser: expected deleted user to be excluded")
+		}
+		if users, err := ListDeletedUser(); err != nil {
+			t.Error("ListDeletedUser: got error:\n", err)
+		} else if len(users) != 1 {
+			t.Errorf("ListDeletedUser: expected 1 user got %d", len(users))
+		}
+
+		if _, err := AuthenticateUser(user.Email, testPassword); err == nil {
+			t.Error("AuthenticateUser: expected error with deleted user")
+		} else if _, ok := err.(*ErrNoEntry); !ok {
+			t.Error("AuthenticateUser: expected error of type ErrNoEntry, got:\n", err)
+		}
+
+		if got, err := GetAnyUser(int(user.ID)); err != nil {
+			t.Error("GetAnyUser: got error:\n", err)
+		} else if !got.IsDeleted() {
+			t.Error("GetAnyUser.Deleted: expected deleted time to be set")
+		}
+
+		if err := user.Restore(); err != nil {
+			t.Error("User.Restore: got error:\n", err)
+		} else if user.IsDeleted() {
+			t.Error("User.IsDeleted: expected false after User.Restore")
+		}
+
+		if _, err := GetUser(user.Email); err != nil {
+			t.Error("GetUser: got error with restored user:\n", err)
+		}
+
+		if err := user.Delete(); err != nil {
+			t.Error("User.Delete: got error:\n", err)
+		}
+		if count, err := PurgeDeletedUsers(shared.Time().Add(time.Second)); err != nil {
+			t.Error("PurgeDeletedUsers: got error:\n", err)
+		} else if count != 1 {
+			t.Errorf("PurgeDeletedUsers: expected 1 user to be purged got %d", count)
+		}
+
+		if _, err := GetAnyUser(user.Email); err == nil {
+			t.Error("GetAnyUser: expected error with purged user")
+		} else if _, ok := err.(*ErrNoEntry); !ok {
+			t.Error("GetAnyUser: expected error of type ErrNoEntry")
+		}
 	})
 }
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/models"
+	"github.com/octacian/extensus/master/template"
+	"github.com/octacian/extensus/shared"
+)
+
+const (
+	tmplAccountName  template.Name  = "account"       // path to account template
+	tmplAccountTitle template.Title = "title.account" // title of account page
+)
+
+// accountData returns the data shared by every render of the account page.
+func accountData(user *models.User) template.Data {
+	return template.Data{
+		"DateFormats": models.DateFormats,
+		"Locales":     i18n.List(),
+		"Themes":      models.Themes,
+		"Now":         shared.Time().In(user.Location()),
+	}
+}
+
+// Account renders the account page of the logged in user.
+func Account(w http.ResponseWriter, r *http.Request) {
+	user, ok := models.UserFromContext(r.Context())
+	if !ok {
+		Error(w, r, http.StatusInternalServerError, errors.New("account: no user in request context"))
+		return
+	}
+
+	template.Render(w, r, tmplAccountName, tmplAccountTitle, accountData(user))
+}
+
+// AccountPost handles changes submitted from the account page. The form field
+// determines which section of the page was submitted. Once the changes are
+// saved the user is redirected back to the account page with a flash.
+func AccountPost(w http.ResponseWriter, r *http.Request) {
+	current, ok := models.UserFromContext(r.Context())
+	if !ok {
+		Error(w, r, http.StatusInternalServerError, errors.New("account: no user in request context"))
+		return
+	}
+
+	// Changes are made to a copy so that a failed save leaves the cached user
+	// untouched.
+	user := *current
+
+	var err error
+	var success string // catalog key of the flash shown once the changes are saved
+	switch r.FormValue("form") {
+	case "profile":
+		success, err = updateProfile(&user, r)
+	case "password":
+		success, err = updatePassword(&user, r)
+	case "avatar":
+		success, err = updateAvatar(&user, r)
+	case "preferences":
+		user.Timezone = r.FormValue("timezone")
+		user.DateFormat = r.FormValue("dateFormat")
+		user.Locale = r.FormValue("locale")
+		user.Theme = r.FormValue("theme")
+		success = "account.preferences.saved"
+	default:
+		Error(w, r, http.StatusBadRequest, nil)
+		return
+	}
+
+	if err == nil {
+		err = user.Save()
+	}
+
+	if err == nil {
+		// The flash is shown in the locale the user may have just chosen.
+		SetFlash(w, template.Flash{Kind: template.FlashSuccess, Message: userLocale(r, &user).T(success)})
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	form := template.NewForm(r)
+	if models.IsErrConflict(err) {
+		form.Fail(i18n.FromContext(r.Context()).T("account.conflict"))
+	} else if !form.AddError(err) {
+		Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := accountData(current)
+	data["Form"] = form
+	template.Render(w, r, tmplAccountName, tmplAccountTitle, data)
+}
+
+// updateProfile applies changes to the name and email of a user. A new email
+// must be entered twice.
+func updateProfile(user *models.User, r *http.Request) (string, error) {
+	email := r.FormValue("email")
+	if email != user.Email && email != r.FormValue("confirmEmail") {
+		return "", &models.ErrInvalid{Model: "user", Which: "confirmEmail", Value: r.FormValue("confirmEmail")}
+	}
+
+	user.Name = r.FormValue("name")
+	user.Email = email
+	return "account.profile.saved", nil
+}
+
+// updatePassword changes the password of a user after checking their current
+// password. The new password must be entered twice.
+func updatePassword(user *models.User, r *http.Request) (string, error) {
+	if err := user.Authenticate(r.FormValue("currentPassword")); err != nil {
+		return "", &models.ErrInvalid{Model: "user", Which: "currentPassword"}
+	}
+
+	password := r.FormValue("password")
+	if password != r.FormValue("confirmPassword") {
+		return "", &models.ErrInvalid{Model: "user", Which: "confirmPassword"}
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return "", err
+	}
+
+	return "account.password.changed", nil
+}
+
+// updateAvatar stores an uploaded avatar image for a user.
+func updateAvatar(user *models.User, r *http.Request) (string, error) {
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		return "", &models.ErrInvalid{Model: "user", Which: "avatar"}
+	}
+	defer file.Close()
+
+	if err := user.SetAvatar(header.Filename, file); err != nil {
+		return "", err
+	}
+
+	return "account.avatar.changed", nil
+}
+
+// Avatar serves the avatar thumbnail of the user whose ID is in the URL.
+func Avatar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		NotFound(w, r)
+		return
+	}
+
+	cached, err := models.Cache(&models.User{}, id)
+	if err != nil {
+		NotFound(w, r)
+		return
+	}
+
+	if user, ok := cached.(*models.User); !ok || user.Avatar == "" {
+		NotFound(w, r)
+	} else {
+		http.ServeFile(w, r, user.AvatarPath())
+	}
+}
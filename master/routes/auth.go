@@ -7,24 +7,29 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/i18n"
 	"github.com/octacian/extensus/master/models"
 	"github.com/octacian/extensus/master/template"
 )
 
 const (
-	tmplLoginName  template.Name  = "login"  // path to login template
-	tmplLoginTitle template.Title = "Log In" // title of login page
+	tmplLoginName  template.Name  = "login"       // path to login template
+	tmplLoginTitle template.Title = "title.login" // title of login page
 
-	tmplForgotName  template.Name  = "forgot"          // path to forgot password template
-	tmplForgotTitle template.Title = "Forgot Password" // title of forgot password page
+	tmplForgotName  template.Name  = "forgot"       // path to forgot password template
+	tmplForgotTitle template.Title = "title.forgot" // title of forgot password page
 )
 
 // SignIn renders the sign in page.
 func SignIn(w http.ResponseWriter, r *http.Request) {
-	returnAfter := r.URL.Query()["return"]
-	template.Render(w, r, tmplLoginName, tmplLoginTitle, template.Data{"Return": returnAfter, "Query": "?" + r.URL.RawQuery})
+	template.Render(w, r, tmplLoginName, tmplLoginTitle, template.Data{"Query": "?" + r.URL.RawQuery})
 }
 
+// authenticationAudience is the audience of tokens identifying signed in users,
+// which keeps tokens signed with the same secret for other purposes, such as
+// invitations, from being accepted in their place.
+const authenticationAudience = "login"
+
 // AuthenticationClaims holds JWT claims information.
 type AuthenticationClaims struct {
 	ID uint64 `json:"id"`
@@ -38,9 +43,11 @@ func SignInPost(w http.ResponseWriter, r *http.Request) {
 
 	if user, err := models.AuthenticateUser(email, password); err != nil {
 		if models.IsErrNoEntry(err) {
-			template.Render(w, r, tmplLoginName, tmplLoginTitle, template.Data{"Failed": true, "Email": email})
+			form := template.NewForm(r)
+			form.Fail(i18n.FromContext(r.Context()).T("login.failed"))
+			template.Render(w, r, tmplLoginName, tmplLoginTitle, template.Data{"Form": form, "Query": "?" + r.URL.RawQuery})
 		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			Error(w, r, http.StatusInternalServerError, err)
 		}
 	} else {
 		// Token will expire in five days from now
@@ -48,6 +55,7 @@ func SignInPost(w http.ResponseWriter, r *http.Request) {
 		claims := &AuthenticationClaims{
 			ID: user.ID,
 			StandardClaims: jwt.StandardClaims{
+				Audience:  authenticationAudience,
 				ExpiresAt: expirationTime.Unix(),
 			},
 		}
@@ -55,7 +63,7 @@ func SignInPost(w http.ResponseWriter, r *http.Request) {
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 		tokenString, err := token.SignedString([]byte(core.GetConfig().Secret))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			Error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -74,7 +82,8 @@ func SignInPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Logout removes the stored token and redirects to the sign in page.
+// Logout removes the stored token and redirects to the sign in page with a
+// flash confirming that the user has been logged out.
 func Logout(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:    "token",
@@ -82,6 +91,7 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 		Expires: time.Unix(0, 0),
 	})
 
+	SetFlash(w, template.Flash{Kind: template.FlashSuccess, Message: i18n.FromContext(r.Context()).T("login.loggedOut")})
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -90,9 +100,16 @@ func Forgot(w http.ResponseWriter, r *http.Request) {
 	template.Render(w, r, tmplForgotName, tmplForgotTitle, nil)
 }
 
-// ForgotPost handles forgot password requests.
+// ForgotPost handles forgot password requests, redirecting back to the forgot
+// password page with a flash once a request has been sent.
 func ForgotPost(w http.ResponseWriter, r *http.Request) {
-	value := r.FormValue("email")
-	res := models.ValidUserEmail.MatchString(value)
-	template.Render(w, r, tmplForgotName, tmplForgotTitle, template.Data{"Email": value, "Valid": res})
+	form := template.NewForm(r)
+	if email := form.Value("email"); !models.ValidUserEmail.MatchString(email) {
+		form.AddError(&models.ErrInvalid{Model: "user", Which: "email", Value: email})
+		template.Render(w, r, tmplForgotName, tmplForgotTitle, template.Data{"Form": form})
+		return
+	}
+
+	SetFlash(w, template.Flash{Kind: template.FlashSuccess, Message: i18n.FromContext(r.Context()).T("forgot.sent")})
+	http.Redirect(w, r, "/forgot", http.StatusSeeOther)
 }
@@ -7,8 +7,8 @@ import (
 )
 
 const (
-	tmplDashboardName  template.Name  = "dashboard" // path to login template
-	tmplDashboardTitle template.Title = "Dashboard" // title of login page
+	tmplDashboardName  template.Name  = "dashboard"       // path to dashboard template
+	tmplDashboardTitle template.Title = "title.dashboard" // title of dashboard page
 )
 
 // Dashboard renders the dashboard page.
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/template"
+	log "github.com/sirupsen/logrus"
+)
+
+const tmplErrorName template.Name = "error" // path to error template
+
+// wantsJSON returns true if the client prefers a JSON response to an HTML one,
+// judged by whichever of the two appears first in the Accept header.
+func wantsJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accepted, ";", 2)[0])
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return true
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			return false
+		}
+	}
+
+	return false
+}
+
+// Error responds to a request with the error page for a status code, or with
+// a JSON error body if the client prefers JSON. The error itself is never
+// shown to the client; if the status is 500 or above it is logged along with
+// the request ID, which the client is given to report instead.
+func Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		fields := log.Fields{"request": middleware.GetReqID(r.Context()), "method": r.Method, "path": r.URL.Path,
+			"status": status}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		log.WithFields(fields).Error("Request failed")
+	}
+
+	renderError(w, r, status)
+}
+
+// renderError writes the error page or JSON error body for a status code,
+// explained in the locale of the request.
+func renderError(w http.ResponseWriter, r *http.Request, status int) {
+	requestID := middleware.GetReqID(r.Context())
+	locale := i18n.FromContext(r.Context())
+	message := http.StatusText(status) + "."
+	if key := fmt.Sprintf("error.%d", status); locale.Has(key) {
+		message = locale.T(key)
+	}
+
+	title := template.Title(http.StatusText(status))
+	if key := fmt.Sprintf("status.%d", status); locale.Has(key) {
+		title = template.Title(key)
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"status":    status,
+				"message":   message,
+				"requestID": requestID,
+			},
+		})
+		return
+	}
+
+	template.RenderStatus(w, r, status, tmplErrorName, title, template.Data{
+		"Status":    status,
+		"Message":   message,
+		"RequestID": requestID,
+	})
+}
+
+// NotFound renders the 404 Not Found error page.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, nil)
+}
+
+// MethodNotAllowed renders the 405 Method Not Allowed error page.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, nil)
+}
+
+// Recover recovers from panics in later handlers, logging the panic with its
+// stack trace and the request ID and rendering the 500 Internal Server Error
+// page in place of the response. http.ErrAbortHandler is passed on so that the
+// server can abort the response as intended. Recover is registered before
+// SecurityHeaders and Localize so that it catches panics in them too, and the
+// error page is rendered through them to give it a nonce and locale.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			log.WithFields(log.Fields{
+				"request": middleware.GetReqID(r.Context()),
+				"panic":   fmt.Sprint(recovered),
+				"stack":   string(debug.Stack()),
+			}).Error("Recovered from panic while serving request")
+
+			SecurityHeaders(Localize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				renderError(w, r, http.StatusInternalServerError)
+			}))).ServeHTTP(w, r)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/shared"
+)
+
+// TestWantsJSON ensures that JSON is only sent to clients that prefer it.
+func TestWantsJSON(t *testing.T) {
+	tests := map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"application/json":                  true,
+		"application/problem+json; q=0.9":   true,
+		"text/html,application/json;q=0.9":  false,
+		"application/json, text/html":       true,
+		"text/html,application/xhtml+xml,*": false,
+	}
+
+	for accept, expected := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		if got := wantsJSON(r); got != expected {
+			t.Errorf("wantsJSON(%q): got %t expected %t", accept, got, expected)
+		}
+	}
+}
+
+// TestMain reads config.json from the root of the source tree rather than the
+// directory of the package.
+func TestMain(m *testing.M) {
+	shared.SetRootDirectory(shared.Abs("."))
+	os.Exit(m.Run())
+}
+
+// TestRecover ensures that panics are turned into a 500 Internal Server Error
+// response that does not reveal what went wrong and is localized and given the
+// security headers.
+func TestRecover(t *testing.T) {
+	locale, ok := i18n.Get("es")
+	if !ok {
+		t.Fatal("i18n.Get: es does not exist")
+	}
+
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("database password is hunter2")
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Accept-Language", "es")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Recover: got status %d expected %d", recorder.Code, http.StatusInternalServerError)
+	}
+	if recorder.Header().Get("Content-Security-Policy") == "" {
+		t.Error("Recover: expected Content-Security-Policy header")
+	}
+
+	var body struct {
+		Error struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Recover: got invalid JSON body '%s':\n%s", recorder.Body.String(), err)
+	}
+	if body.Error.Status != http.StatusInternalServerError || body.Error.Message != locale.T("error.500") {
+		t.Errorf("Recover: got body '%s'", recorder.Body.String())
+	}
+}
@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/octacian/extensus/master/static"
+)
+
+// compressionLevel is the gzip level responses are compressed with.
+const compressionLevel = 5
+
+var (
+	// compressedTypes lists the content types of the responses compressed as
+	// they are written. Static files are instead served precompressed.
+	compressedTypes = []string{"text/html", "application/json"}
+
+	// encodings lists the content encodings of the precompressed variants of
+	// static files in order of preference, mapped to their file extensions.
+	encodings = []struct{ name, extension string }{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+
+	// cacheDurations maps the extensions of static files to how long browsers
+	// may use them without revalidating if they are not requested by a URL
+	// holding their hash. Files of other types must always be revalidated.
+	cacheDurations = map[string]time.Duration{
+		".woff2": 30 * 24 * time.Hour,
+		".woff":  30 * 24 * time.Hour,
+		".ttf":   30 * 24 * time.Hour,
+		".otf":   30 * 24 * time.Hour,
+		".png":   24 * time.Hour,
+		".jpg":   24 * time.Hour,
+		".jpeg":  24 * time.Hour,
+		".gif":   24 * time.Hour,
+		".svg":   24 * time.Hour,
+		".webp":  24 * time.Hour,
+		".ico":   24 * time.Hour,
+	}
+)
+
+// ServeFiles serves static files from public, along with the stylesheets
+// compiled from public/scss, read from the asset directory if one is set or
+// from the embedded copies otherwise. Directories are not listed.
+func ServeFiles(router chi.Router) {
+	router.Get("/public/*", serveFile)
+}
+
+// cacheControl returns the Cache-Control header for a static file. Files
+// requested by a URL holding the hash of their current contents, as given by
+// static.URL, never change and may be cached forever.
+func cacheControl(name string, current bool) string {
+	if current {
+		return "public, max-age=31536000, immutable"
+	}
+
+	if duration, ok := cacheDurations[strings.ToLower(path.Ext(name))]; ok {
+		return "public, max-age=" + strconv.Itoa(int(duration.Seconds()))
+	}
+
+	return "no-cache"
+}
+
+// acceptsEncoding returns true if the Accept-Encoding header of a request
+// allows a content encoding, either by name or with a wildcard.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	wildcard := false
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(accepted, ";")
+		name := strings.TrimSpace(fields[0])
+		if name != encoding && name != "*" {
+			continue
+		}
+
+		allowed := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if quality, err := strconv.ParseFloat(param[2:], 64); err == nil && quality == 0 {
+					allowed = false
+				}
+			}
+		}
+
+		if name == encoding {
+			return allowed
+		}
+		wildcard = allowed
+	}
+
+	return wildcard
+}
+
+// openVariant opens the precompressed variant of a static file preferred by
+// the client, such as index.css.br, or the file itself if there is none. The
+// content encoding of the file opened is returned, empty for the file itself.
+func openVariant(files fs.FS, name string, r *http.Request) (fs.File, string, error) {
+	for _, encoding := range encodings {
+		if !acceptsEncoding(r, encoding.name) {
+			continue
+		}
+		if file, err := files.Open(name + encoding.extension); err == nil {
+			return file, encoding.name, nil
+		}
+	}
+
+	file, err := files.Open(name)
+	return file, "", err
+}
+
+// serveFile serves a file under /public, using a precompressed variant if the
+// client accepts one. Files are cached according to cacheControl and may be
+// revalidated with their ETag.
+func serveFile(w http.ResponseWriter, r *http.Request) {
+	name, hash, current := static.Lookup(strings.TrimPrefix(r.URL.Path, "/public/"))
+
+	files := static.FS()
+	info, err := fs.Stat(files, name)
+	if err != nil || info.IsDir() {
+		NotFound(w, r)
+		return
+	}
+
+	file, encoding, err := openVariant(files, name, r)
+	if err != nil {
+		Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		Error(w, r, http.StatusInternalServerError, errors.New("serveFile: "+name+" cannot seek"))
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", cacheControl(name, current))
+	header.Set("Vary", "Accept-Encoding")
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	} else if encoding != "" {
+		// The type cannot be sniffed from compressed content.
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		if hash != "" {
+			hash += "-" + encoding
+		}
+	}
+	if hash != "" {
+		header.Set("ETag", `"`+hash+`"`)
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/octacian/extensus/master/static"
+)
+
+// TestAcceptsEncoding ensures that encodings are only used if the client
+// allows them.
+func TestAcceptsEncoding(t *testing.T) {
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"br, gzip;q=0.5":    true,
+		"gzip;q=0":          false,
+		"*":                 true,
+		"*, gzip;q=0":       false,
+		"deflate, identity": false,
+		"x-gzip":            false,
+	}
+
+	for header, expected := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", header)
+		if got := acceptsEncoding(r, "gzip"); got != expected {
+			t.Errorf("acceptsEncoding(%q, gzip): got %t expected %t", header, got, expected)
+		}
+	}
+}
+
+// TestCacheControl ensures that fingerprinted files are cached forever and
+// that other files are cached according to their type.
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  bool
+		expected string
+	}{
+		{"css/index.css", true, "public, max-age=31536000, immutable"},
+		{"css/index.css", false, "no-cache"},
+		{"fonts/example.woff2", false, "public, max-age=2592000"},
+		{"images/Logo.PNG", false, "public, max-age=86400"},
+	}
+
+	for _, test := range tests {
+		if got := cacheControl(test.name, test.current); got != test.expected {
+			t.Errorf("cacheControl(%s, %t): got '%s' expected '%s'", test.name, test.current, got, test.expected)
+		}
+	}
+}
+
+// TestServeFile ensures that stylesheets are served gzipped to clients that
+// accept it, can be revalidated with their ETag and that directories are not
+// listed.
+func TestServeFile(t *testing.T) {
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", "application/json")
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		serveFile(recorder, r)
+		return recorder
+	}
+
+	recorder := serve(static.URL("css/index.css"), map[string]string{"Accept-Encoding": "gzip"})
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("serveFile: got status %d with headers %v expected a gzipped stylesheet", recorder.Code,
+			recorder.Header())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/css; charset=utf-8" {
+		t.Errorf("serveFile: got Content-Type '%s' expected 'text/css; charset=utf-8'", contentType)
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal("gzip.NewReader: got error:\n", err)
+	}
+	if css, err := io.ReadAll(reader); err != nil || len(css) == 0 {
+		t.Errorf("serveFile: got invalid gzipped stylesheet: %v", err)
+	}
+
+	recorder = serve("/public/css/index.css", nil)
+	etag := recorder.Header().Get("ETag")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Encoding") != "" || etag == "" {
+		t.Fatalf("serveFile: got status %d with headers %v expected a plain stylesheet", recorder.Code,
+			recorder.Header())
+	}
+	if recorder := serve("/public/css/index.css", map[string]string{"If-None-Match": etag}); recorder.Code != http.StatusNotModified {
+		t.Errorf("serveFile: got status %d for matching ETag expected %d", recorder.Code, http.StatusNotModified)
+	}
+
+	for _, path := range []string{"/public/", "/public/scss", "/public/scss/", "/public/missing.css"} {
+		if recorder := serve(path, nil); recorder.Code != http.StatusNotFound {
+			t.Errorf("serveFile(%s): got status %d expected %d", path, recorder.Code, http.StatusNotFound)
+		}
+	}
+}
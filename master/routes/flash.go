@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/template"
+	log "github.com/sirupsen/logrus"
+)
+
+const flashCookie = "flash" // name of the cookie flashes are kept in until shown
+
+// errBadFlash is returned by decodeFlashes if a cookie was not signed with the
+// secret or cannot be read.
+var errBadFlash = errors.New("flash: invalid cookie")
+
+// signFlashes returns the signature of encoded flashes.
+func signFlashes(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeFlashes returns flashes as a cookie value signed with the secret.
+func encodeFlashes(flashes []template.Flash, secret []byte) (string, error) {
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signFlashes(payload, secret), nil
+}
+
+// decodeFlashes returns the flashes held in a cookie value created by
+// encodeFlashes with the same secret. If the value has been tampered with or
+// cannot be read, errBadFlash is returned.
+func decodeFlashes(value string, secret []byte) ([]template.Flash, error) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(signFlashes(parts[0], secret)), []byte(parts[1])) {
+		return nil, errBadFlash
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errBadFlash
+	}
+
+	var flashes []template.Flash
+	if err := json.Unmarshal(data, &flashes); err != nil {
+		return nil, errBadFlash
+	}
+
+	return flashes, nil
+}
+
+// SetFlash stores flashes in a signed cookie so that they are shown on the
+// next page rendered, usually the one redirected to. Flashes set earlier in
+// the same response are replaced.
+func SetFlash(w http.ResponseWriter, flashes ...template.Flash) {
+	value, err := encodeFlashes(flashes, []byte(core.GetConfig().Secret))
+	if err != nil {
+		log.Error("SetFlash: got error while encoding flashes:\n", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Flashes moves the flashes stored by SetFlash into the request context so
+// that template.Render shows them, and removes the cookie so that they are
+// only shown once. Cookies that have been tampered with are discarded.
+func Flashes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(flashCookie)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     flashCookie,
+			Value:    "",
+			Path:     "/",
+			Expires:  time.Unix(0, 0),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		flashes, err := decodeFlashes(cookie.Value, []byte(core.GetConfig().Secret))
+		if err != nil {
+			log.WithFields(log.Fields{"error": err.Error()}).Warn("Flashes discarded an invalid cookie")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(template.NewFlashContext(r.Context(), flashes)))
+	})
+}
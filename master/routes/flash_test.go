@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/octacian/extensus/master/template"
+)
+
+// TestDecodeFlashes ensures that flashes survive being stored in a cookie and
+// that cookies which were not signed with the secret are rejected.
+func TestDecodeFlashes(t *testing.T) {
+	secret := []byte("secret")
+	flashes := []template.Flash{
+		{Kind: template.FlashSuccess, Message: "Your profile has been saved."},
+		{Kind: template.FlashFailure, Message: "You must log in to continue."},
+	}
+
+	value, err := encodeFlashes(flashes, secret)
+	if err != nil {
+		t.Fatal("encodeFlashes: got error:\n", err)
+	}
+
+	decoded, err := decodeFlashes(value, secret)
+	if err != nil {
+		t.Fatal("decodeFlashes: got error:\n", err)
+	} else if len(decoded) != len(flashes) || decoded[0] != flashes[0] || decoded[1] != flashes[1] {
+		t.Errorf("decodeFlashes: got %v expected %v", decoded, flashes)
+	}
+
+	forged, _ := encodeFlashes(flashes, []byte("other"))
+	for _, value := range []string{forged, value[1:], "", "."} {
+		if _, err := decodeFlashes(value, secret); err != errBadFlash {
+			t.Errorf("decodeFlashes(%q): expected errBadFlash, got: %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/models"
+	"github.com/octacian/extensus/master/template"
+)
+
+const (
+	tmplInviteName  template.Name  = "invite"       // path to invite template
+	tmplInviteTitle template.Title = "title.invite" // title of invite page
+
+	tmplAcceptName  template.Name  = "accept"       // path to accept invitation template
+	tmplAcceptTitle template.Title = "title.accept" // title of accept invitation page
+)
+
+// Invite renders the page used to invite new users.
+func Invite(w http.ResponseWriter, r *http.Request) {
+	template.Render(w, r, tmplInviteName, tmplInviteTitle, nil)
+}
+
+// InvitePost creates and sends an invitation to the email submitted, then
+// redirects back to the invite page with a flash saying when it expires.
+func InvitePost(w http.ResponseWriter, r *http.Request) {
+	user, ok := models.UserFromContext(r.Context())
+	if !ok {
+		Error(w, r, http.StatusInternalServerError, errors.New("invite: no user in request context"))
+		return
+	}
+
+	email := r.FormValue("email")
+	invite, err := models.NewInvite(email, user)
+	if err == nil {
+		if err = invite.Save(); err == nil {
+			err = invite.Send()
+		}
+	}
+
+	form := template.NewForm(r)
+	if err != nil {
+		if !form.AddError(err) {
+			Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		template.Render(w, r, tmplInviteName, tmplInviteTitle, template.Data{"Form": form})
+		return
+	}
+
+	expires := invite.Expires.In(user.Location()).Format(user.DateLayout())
+	message := i18n.FromContext(r.Context()).T("invite.sent", invite.Email, expires)
+	SetFlash(w, template.Flash{Kind: template.FlashSuccess, Message: message})
+	http.Redirect(w, r, "/invite", http.StatusSeeOther)
+}
+
+// AcceptInvite renders the page where an invited user creates their account.
+// If the invitation in the URL cannot be used the reason is shown instead.
+func AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	invite, err := models.ParseInviteToken(chi.URLParam(r, "token"))
+	if invalid, ok := err.(*models.ErrInvalid); ok {
+		template.Render(w, r, tmplAcceptName, tmplAcceptTitle, template.Data{"Unusable": "accept.unusable." + invalid.Code})
+	} else if err != nil {
+		Error(w, r, http.StatusInternalServerError, err)
+	} else {
+		template.Render(w, r, tmplAcceptName, tmplAcceptTitle, template.Data{"Invite": invite})
+	}
+}
+
+// AcceptInvitePost creates the account of an invited user with the name and
+// password submitted, then redirects to the sign in page with a flash. The
+// password must be entered twice.
+func AcceptInvitePost(w http.ResponseWriter, r *http.Request) {
+	invite, err := models.ParseInviteToken(chi.URLParam(r, "token"))
+	if invalid, ok := err.(*models.ErrInvalid); ok {
+		template.Render(w, r, tmplAcceptName, tmplAcceptTitle, template.Data{"Unusable": "accept.unusable." + invalid.Code})
+		return
+	} else if err != nil {
+		Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	form := template.NewForm(r)
+	data := template.Data{"Invite": invite, "Form": form}
+	password := form.Value("password")
+	if password != form.Value("confirmPassword") {
+		form.AddError(&models.ErrInvalid{Model: "user", Which: "confirmPassword"})
+		template.Render(w, r, tmplAcceptName, tmplAcceptTitle, data)
+		return
+	}
+
+	if _, err := invite.Accept(form.Value("name"), password); err != nil {
+		if models.IsErrBadEffect(err) {
+			data = template.Data{"Unusable": "accept.unusable.used"}
+		} else if !form.AddError(err) {
+			Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		template.Render(w, r, tmplAcceptName, tmplAcceptTitle, data)
+		return
+	}
+
+	SetFlash(w, template.Flash{Kind: template.FlashSuccess, Message: i18n.FromContext(r.Context()).T("accept.created")})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
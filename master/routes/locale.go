@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/models"
+)
+
+// Localize chooses the locale a request is served in from its Accept-Language
+// header. Authorization replaces it with the locale chosen by the logged in
+// user, if any.
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+		next.ServeHTTP(w, r.WithContext(locale.NewContext(r.Context())))
+	})
+}
+
+// userLocale returns the locale chosen by a user or the locale of the request
+// if the user follows their browser.
+func userLocale(r *http.Request, user *models.User) *i18n.Locale {
+	if locale, ok := i18n.Get(user.Locale); ok && user.Locale != "" {
+		return locale
+	}
+
+	return i18n.FromContext(r.Context())
+}
@@ -4,10 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/i18n"
 	"github.com/octacian/extensus/master/models"
+	"github.com/octacian/extensus/master/template"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -42,7 +45,7 @@ func authorized(w http.ResponseWriter, r *http.Request) (*models.User, error) {
 		}
 
 		if claims, ok := token.Claims.(*AuthenticationClaims); ok {
-			if token.Valid {
+			if token.Valid && claims.Audience == authenticationAudience {
 				cached, err := models.Cache(&models.User{}, int(claims.ID))
 				if err != nil {
 					return nil, http.StatusBadRequest, err
@@ -71,12 +74,12 @@ func authorized(w http.ResponseWriter, r *http.Request) (*models.User, error) {
 		if status == 0 {
 			status = http.StatusInternalServerError
 		}
-		http.Error(w, fmt.Sprintf("authenticate: got error: %s", err.Error()), status)
+		Error(w, r, status, fmt.Errorf("authenticate: got error: %s", err))
 		return nil, err // Error occurred.
 	}
 
 	if status != 0 {
-		w.WriteHeader(status) // Error occurred.
+		Error(w, r, status, nil) // Error occurred.
 		return nil, fmt.Errorf("authenticate: got illegal return status of %d but no error message", status)
 	}
 
@@ -97,16 +100,37 @@ func NoAuthorization(next http.Handler) http.Handler {
 	})
 }
 
-// Authorization ensures that requests contain a valid JWT token.
+// passwordExpiredPaths lists the paths that can still be visited by users
+// whose password has expired.
+var passwordExpiredPaths = []string{"/account", "/avatar/", "/logout"}
+
+// Authorization ensures that requests contain a valid JWT token. Users whose
+// password has expired are redirected to the account page.
 func Authorization(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if user, err := authorized(w, r); err != nil { // Error occurred.
 			log.WithFields(log.Fields{"error": err.Error()}).Error("Authorization failed with an unexpected error")
 		} else if user == nil && err == nil { // Authentication unsuccessful, redirect to login.
+			message := i18n.FromContext(r.Context()).T("login.required")
+			SetFlash(w, template.Flash{Kind: template.FlashFailure, Message: message})
 			http.Redirect(w, r, fmt.Sprintf("/?return=%s", r.RequestURI), http.StatusSeeOther)
+		} else if user.PasswordExpired() && !hasAnyPrefix(r.URL.Path, passwordExpiredPaths) { // Password expired.
+			http.Redirect(w, r, "/account", http.StatusSeeOther)
 		} else { // Authentication successful, serve request.
-			newRequest := r.WithContext(user.NewContext(r.Context()))
+			ctx := userLocale(r, user).NewContext(user.NewContext(r.Context()))
+			newRequest := r.WithContext(ctx)
 			next.ServeHTTP(w, newRequest)
 		}
 	})
 }
+
+// hasAnyPrefix returns true if the path starts with any of the prefixes.
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,56 +4,100 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/static"
 	"github.com/octacian/extensus/master/template"
-	"github.com/octacian/extensus/shared"
 
+	"context"
+	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// Serve starts the HTTP server. If any errors occur, Serve panics.
-func Serve() {
+// defaultShutdownTimeout is used if no shutdown timeout is configured.
+const defaultShutdownTimeout = 10 * time.Second
+
+// Serve starts the HTTP server and blocks until the context is done. Requests
+// in progress are then given until the configured shutdown timeout to finish
+// before the server stops. If the server fails to start or stop, an error is
+// returned. If any other errors occur, Serve panics.
+func Serve(ctx context.Context) error {
 	template.ParseAll()
+	if err := static.Build(); err != nil {
+		return fmt.Errorf("Serve: got error while building static files: %s", err)
+	}
 	if os.Getenv("MODE") == "DEV" {
-		go template.WatchAll()
+		go template.WatchAll(ctx)
+		go static.Watch(ctx)
 	}
 
 	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
 	router.Use(middleware.Logger)
+	router.Use(Recover)
+	router.Use(middleware.Compress(compressionLevel, compressedTypes...))
+	router.Use(SecurityHeaders)
+	router.Use(Localize)
+	router.Use(Flashes)
+	router.NotFound(NotFound)
+	router.MethodNotAllowed(MethodNotAllowed)
 
 	router.Route("/", func(router chi.Router) {
 		router.Group(func(router chi.Router) {
 			router.Use(NoAuthorization)
-			router.Get("/", SignIn)
+			router.Get(template.NamedRoute("signIn", "/"), SignIn)
 			router.Post("/", SignInPost)
-			router.Get("/forgot", Forgot)
+			router.Get(template.NamedRoute("forgot", "/forgot"), Forgot)
 			router.Post("/forgot", ForgotPost)
+			router.Get(template.NamedRoute("acceptInvite", "/invite/{token}"), AcceptInvite)
+			router.Post("/invite/{token}", AcceptInvitePost)
 		})
 
 		router.Group(func(router chi.Router) {
 			router.Use(Authorization)
-			router.Get("/logout", Logout)
-			router.Get("/dashboard", Dashboard)
-			router.Get("/nodes", Nodes)
+			router.Get(template.NamedRoute("logout", "/logout"), Logout)
+			router.Get(template.NamedRoute("dashboard", "/dashboard"), Dashboard)
+			router.Get(template.NamedRoute("account", "/account"), Account)
+			router.Post("/account", AccountPost)
+			router.Get(template.NamedRoute("avatar", "/avatar/{id}"), Avatar)
+			router.Get(template.NamedRoute("invite", "/invite"), Invite)
+			router.Post("/invite", InvitePost)
+			router.Get(template.NamedRoute("nodes", "/nodes"), Nodes)
 		})
 	})
 
 	ServeFiles(router)
 
-	address := core.GetConfig().Address
-	log.WithFields(log.Fields{"address": address}).Info("HTTP server listening")
-	log.Fatal(http.ListenAndServe(address, router))
-}
+	server := &http.Server{Addr: core.GetConfig().Address, Handler: router}
+	failed := make(chan error, 1)
+	go func() {
+		log.WithFields(log.Fields{"address": server.Addr}).Info("HTTP server listening")
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return fmt.Errorf("Serve: got error while listening: %s", err)
+	case <-ctx.Done():
+	}
+
+	timeout := time.Duration(core.GetConfig().Shutdown) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
 
-// ServeFiles starts a http.FileServer to serve static files from public.
-func ServeFiles(router chi.Router) {
-	fs := http.StripPrefix("/public", http.FileServer(http.Dir(shared.Abs("public"))))
+	log.WithFields(log.Fields{"timeout": timeout}).Info("HTTP server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	router.Get("/public", http.RedirectHandler("/public/", 301).ServeHTTP)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("Serve: got error while shutting down: %s", err)
+	}
 
-	router.Get("/public/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fs.ServeHTTP(w, r)
-	}))
+	log.Info("HTTP server stopped")
+	return nil
 }
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/octacian/extensus/master/core"
+	"github.com/octacian/extensus/master/template"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFrameOptions   = "DENY"        // used if no X-Frame-Options value is configured
+	defaultReferrerPolicy = "same-origin" // used if no Referrer-Policy is configured
+
+	// nonceBytes is the number of random bytes in a nonce.
+	nonceBytes = 16
+
+	// defaultPolicy is the Content-Security-Policy used if none is configured.
+	// Only resources served by the master itself and the fonts and icons from
+	// Google Fonts are allowed, besides inline scripts and styles carrying the
+	// nonce of the response.
+	defaultPolicy = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; " +
+		"style-src 'self' 'nonce-{nonce}' https://fonts.googleapis.com; img-src 'self' data:{logo}; " +
+		"font-src 'self' https://fonts.gstatic.com; object-src 'none'; base-uri 'self'; form-action 'self'; " +
+		"frame-ancestors 'none'"
+)
+
+// newNonce returns a random base64 encoded nonce.
+func newNonce() (string, error) {
+	nonce := make([]byte, nonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// contentSecurityPolicy returns the configured Content-Security-Policy, or else
+// the default policy allowing images from the origin of the configured logo,
+// with the nonce given in place of {nonce}.
+func contentSecurityPolicy(config *core.Configuration, nonce string) string {
+	policy := config.Security.ContentSecurityPolicy
+	if policy == "" {
+		logo := ""
+		if parsed, err := url.Parse(config.Branding.Logo); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+			logo = fmt.Sprintf(" %s://%s", parsed.Scheme, parsed.Host)
+		}
+		policy = strings.Replace(defaultPolicy, "{logo}", logo, 1)
+	}
+
+	return strings.Replace(policy, "{nonce}", nonce, -1)
+}
+
+// isHTTPS returns true if the request was made over TLS, either to the master
+// itself or to a proxy in front of it.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// SecurityHeaders sets the Content-Security-Policy, X-Frame-Options,
+// Referrer-Policy and X-Content-Type-Options headers of every response, along
+// with Strict-Transport-Security if the request was made over HTTPS. A nonce
+// is generated for each request and stored in its context, where
+// template.Render passes it to templates as Nonce for use by inline scripts
+// and styles.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := core.GetConfig()
+
+		nonce, err := newNonce()
+		if err != nil {
+			log.Error("SecurityHeaders: got error while generating nonce:\n", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		frameOptions := config.Security.FrameOptions
+		if frameOptions == "" {
+			frameOptions = defaultFrameOptions
+		}
+		referrerPolicy := config.Security.ReferrerPolicy
+		if referrerPolicy == "" {
+			referrerPolicy = defaultReferrerPolicy
+		}
+
+		header := w.Header()
+		header.Set("Content-Security-Policy", contentSecurityPolicy(config, nonce))
+		header.Set("X-Frame-Options", frameOptions)
+		header.Set("Referrer-Policy", referrerPolicy)
+		header.Set("X-Content-Type-Options", "nosniff")
+		if config.Security.HSTSMaxAge > 0 && isHTTPS(r) {
+			header.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains",
+				config.Security.HSTSMaxAge))
+		}
+
+		next.ServeHTTP(w, r.WithContext(template.NewNonceContext(r.Context(), nonce)))
+	})
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/octacian/extensus/master/core"
+)
+
+// TestContentSecurityPolicy ensures that the nonce is written into the default
+// and configured policies and that Google Fonts and the origin of an external
+// logo are allowed.
+func TestContentSecurityPolicy(t *testing.T) {
+	config := &core.Configuration{}
+	policy := contentSecurityPolicy(config, "abc")
+	for _, expected := range []string{"script-src 'self' 'nonce-abc';",
+		"style-src 'self' 'nonce-abc' https://fonts.googleapis.com;", "img-src 'self' data:;",
+		"font-src 'self' https://fonts.gstatic.com;"} {
+		if !strings.Contains(policy, expected) {
+			t.Errorf("contentSecurityPolicy: expected %q in policy: %s", expected, policy)
+		}
+	}
+
+	config.Branding.Logo = "https://cdn.example.com/logo.png"
+	if policy := contentSecurityPolicy(config, "abc"); !strings.Contains(policy, "img-src 'self' data: https://cdn.example.com;") {
+		t.Errorf("contentSecurityPolicy: expected logo origin in policy: %s", policy)
+	}
+
+	config.Security.ContentSecurityPolicy = "default-src 'none'; style-src 'nonce-{nonce}'"
+	if policy := contentSecurityPolicy(config, "abc"); policy != "default-src 'none'; style-src 'nonce-abc'" {
+		t.Errorf("contentSecurityPolicy: got '%s' for configured policy", policy)
+	}
+}
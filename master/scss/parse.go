@@ -0,0 +1,181 @@
+package scss
+
+import (
+	"fmt"
+	"strings"
+)
+
+// node is a statement in a stylesheet: either a declaration or other
+// statement ending in a semicolon, or a rule or at-rule followed by a block.
+type node struct {
+	text     string  // declaration, selector or at-rule trimmed of whitespace
+	children []*node // statements within the block
+	block    bool    // whether the statement is followed by a block
+	line     int
+}
+
+// parser splits the source of a stylesheet into nodes.
+type parser struct {
+	path   string
+	source string
+	pos    int
+}
+
+// parse returns the statements in the source of a stylesheet.
+func parse(path, source string) ([]*node, error) {
+	p := &parser{path: path, source: stripComments(source)}
+	return p.parseBlock(false)
+}
+
+// stripComments replaces comments with spaces, keeping newlines so that line
+// numbers are preserved. Slashes within strings and parentheses, such as those
+// of a URL, are left alone.
+func stripComments(source string) string {
+	out := []byte(source)
+	depth := 0
+	var quote byte
+	for i := 0; i < len(out); i++ {
+		switch char := out[i]; {
+		case quote != 0:
+			if char == '\\' {
+				i++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '(':
+			depth++
+		case char == ')' && depth > 0:
+			depth--
+		case char == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := strings.Index(source[i+2:], "*/")
+			if end == -1 {
+				end = len(out)
+			} else {
+				end += i + 4
+			}
+			blank(out[i:end])
+			i = end - 1
+		case char == '/' && i+1 < len(out) && out[i+1] == '/' && depth == 0:
+			end := strings.IndexByte(source[i:], '\n')
+			if end == -1 {
+				end = len(out)
+			} else {
+				end += i
+			}
+			blank(out[i:end])
+			i = end - 1
+		}
+	}
+
+	return string(out)
+}
+
+// blank replaces every byte other than a newline with a space.
+func blank(text []byte) {
+	for i := range text {
+		if text[i] != '\n' {
+			text[i] = ' '
+		}
+	}
+}
+
+// lineAt returns the line number of a position in the source.
+func (p *parser) lineAt(pos int) int {
+	return strings.Count(p.source[:pos], "\n") + 1
+}
+
+// errorf returns an ErrSyntax for a position in the source.
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &ErrSyntax{Path: p.path, Line: p.lineAt(pos), Message: fmt.Sprintf(format, args...)}
+}
+
+// parseBlock returns the statements up to the end of the source or, if nested,
+// the closing brace of the current block.
+func (p *parser) parseBlock(nested bool) ([]*node, error) {
+	nodes := []*node{}
+	for {
+		for p.pos < len(p.source) && strings.IndexByte(" \t\r\n", p.source[p.pos]) != -1 {
+			p.pos++
+		}
+
+		if p.pos >= len(p.source) {
+			if nested {
+				return nil, p.errorf(p.pos, "expected }")
+			}
+			return nodes, nil
+		}
+
+		if p.source[p.pos] == '}' {
+			if !nested {
+				return nil, p.errorf(p.pos, "unexpected }")
+			}
+			p.pos++
+			return nodes, nil
+		}
+
+		start := p.pos
+		text, end, err := p.scanStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		statement := &node{text: strings.TrimSpace(text), line: p.lineAt(start)}
+		switch end {
+		case '{':
+			p.pos++
+			if statement.children, err = p.parseBlock(true); err != nil {
+				return nil, err
+			}
+			statement.block = true
+		case ';':
+			p.pos++
+		}
+
+		if statement.text != "" || statement.block {
+			nodes = append(nodes, statement)
+		}
+	}
+}
+
+// scanStatement reads up to the semicolon or brace ending a statement,
+// skipping over strings, parentheses and interpolation. The character that
+// ended the statement is returned and left unread, or 0 at the end of the
+// source.
+func (p *parser) scanStatement() (string, byte, error) {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.source) {
+		char := p.source[p.pos]
+		switch {
+		case char == '"' || char == '\'':
+			end := p.pos + 1
+			for end < len(p.source) && p.source[end] != char {
+				if p.source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(p.source) {
+				return "", 0, p.errorf(p.pos, "unterminated string")
+			}
+			p.pos = end
+		case char == '#' && p.pos+1 < len(p.source) && p.source[p.pos+1] == '{':
+			end := strings.IndexByte(p.source[p.pos:], '}')
+			if end == -1 {
+				return "", 0, p.errorf(p.pos, "unterminated interpolation")
+			}
+			p.pos += end
+		case char == '(':
+			depth++
+		case char == ')':
+			depth--
+		case depth <= 0 && (char == ';' || char == '{' || char == '}'):
+			return p.source[start:p.pos], char, nil
+		}
+		p.pos++
+	}
+
+	return p.source[start:p.pos], 0, nil
+}
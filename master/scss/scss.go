@@ -0,0 +1,778 @@
+// Package scss compiles the subset of SCSS used by the stylesheets in public
+// into CSS, so that no external tools are needed to build the web interface.
+// Variables, nested rules with parent references, interpolation, arithmetic
+// on numbers, mixins, placeholder selectors with @extend, partials with
+// @import and at-rules such as @media and @font-face are supported. Control
+// directives, functions and modules are not.
+package scss
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// indent is the indentation used for each level of nesting in the output.
+const indent = "  "
+
+var (
+	// variablePattern matches references to variables.
+	variablePattern = regexp.MustCompile(`\$[A-Za-z_][\w-]*`)
+
+	// numberPattern matches numbers with an optional unit.
+	numberPattern = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+))([A-Za-z%]*)$`)
+
+	// callPattern matches the name and arguments of a mixin.
+	callPattern = regexp.MustCompile(`^([\w-]+)\s*(?:\((.*)\))?$`)
+
+	// conditionalRules are the at-rules whose blocks hold rules, and within
+	// which declarations apply to the selectors of the enclosing rule.
+	conditionalRules = []string{"@media", "@supports", "@document", "@layer", "@container"}
+
+	// unsupportedRules are the Sass at-rules which are not supported.
+	unsupportedRules = []string{"@if", "@else", "@each", "@for", "@while", "@function", "@return", "@use",
+		"@forward", "@at-root", "@content"}
+)
+
+// ErrSyntax is returned if a stylesheet cannot be compiled.
+type ErrSyntax struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+// Error implements the error interface for ErrSyntax.
+func (err *ErrSyntax) Error() string {
+	return fmt.Sprintf("scss: %s:%d: %s", err.Path, err.Line, err.Message)
+}
+
+// IsErrSyntax returns true if the error is an ErrSyntax.
+func IsErrSyntax(err error) bool {
+	_, ok := err.(*ErrSyntax)
+	return ok
+}
+
+// scope holds the variables of a block and refers to those of the enclosing
+// block.
+type scope struct {
+	variables map[string]string
+	parent    *scope
+}
+
+// newScope returns an empty scope within a parent.
+func newScope(parent *scope) *scope {
+	return &scope{variables: make(map[string]string), parent: parent}
+}
+
+// lookup returns the value of a variable in the scope or an enclosing scope.
+func (s *scope) lookup(name string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if value, ok := s.variables[name]; ok {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// mixin is a block of statements that can be included with @include.
+type mixin struct {
+	params   []string          // names of the parameters in order
+	defaults map[string]string // default values of optional parameters
+	body     []*node
+	path     string
+}
+
+// extension records that a selector extends another with @extend.
+type extension struct {
+	target   string
+	selector string
+}
+
+// item is a rule or at-rule in the output.
+type item struct {
+	selectors    []string // selectors of a rule, nil for an at-rule
+	rule         string   // prelude of an at-rule, empty for a rule
+	declarations []string
+	children     []*item
+}
+
+// context holds the state statements are evaluated in.
+type context struct {
+	path      string   // stylesheet the statements are from
+	scope     *scope   // variables in scope
+	selectors []string // selectors of the enclosing rule, nil at the top level
+	parent    *item    // item declarations are added to, nil if none
+	out       *[]*item // list rules and at-rules are added to
+}
+
+// compiler holds the state of a compilation.
+type compiler struct {
+	fsys       fs.FS
+	globals    *scope
+	mixins     map[string]*mixin
+	extensions []extension
+	imports    []string // plain CSS at-rules such as @import, written first
+	importing  []string // stylesheets being imported, to detect cycles
+}
+
+// Compile compiles a stylesheet in a file system into CSS. Imports are
+// resolved relative to the stylesheet importing them, trying the path itself
+// with .scss appended and then with an underscore prefixed to the file name.
+// If the stylesheet cannot be read or compiled an error is returned.
+func Compile(fsys fs.FS, name string) ([]byte, error) {
+	c := &compiler{fsys: fsys, globals: newScope(nil), mixins: make(map[string]*mixin)}
+
+	items := []*item{}
+	ctx := &context{path: name, scope: c.globals, out: &items}
+	if err := c.importFile(ctx, name, 0); err != nil {
+		return nil, err
+	}
+
+	c.extend(items)
+
+	var out strings.Builder
+	for _, rule := range c.imports {
+		out.WriteString(rule + ";\n")
+	}
+	for _, rendered := range renderItems(items, "") {
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(rendered)
+	}
+
+	return []byte(out.String()), nil
+}
+
+// importFile evaluates the statements of a stylesheet in a context.
+func (c *compiler) importFile(ctx *context, name string, line int) error {
+	for _, importing := range c.importing {
+		if importing == name {
+			return &ErrSyntax{Path: ctx.path, Line: line, Message: "import loop through " + name}
+		}
+	}
+
+	source, err := fs.ReadFile(c.fsys, name)
+	if err != nil {
+		if line == 0 {
+			return err
+		}
+		return &ErrSyntax{Path: ctx.path, Line: line, Message: err.Error()}
+	}
+
+	nodes, err := parse(name, string(source))
+	if err != nil {
+		return err
+	}
+
+	c.importing = append(c.importing, name)
+	defer func() { c.importing = c.importing[:len(c.importing)-1] }()
+
+	imported := *ctx
+	imported.path = name
+	return c.evaluate(&imported, nodes)
+}
+
+// errorf returns an ErrSyntax for a statement.
+func errorf(ctx *context, n *node, format string, args ...interface{}) error {
+	return &ErrSyntax{Path: ctx.path, Line: n.line, Message: fmt.Sprintf(format, args...)}
+}
+
+// evaluate evaluates statements in a context.
+func (c *compiler) evaluate(ctx *context, nodes []*node) error {
+	for _, n := range nodes {
+		var err error
+		switch {
+		case strings.HasPrefix(n.text, "@"):
+			err = c.evaluateAtRule(ctx, n)
+		case n.block:
+			err = c.evaluateRule(ctx, n)
+		case strings.HasPrefix(n.text, "$"):
+			err = c.evaluateVariable(ctx, n)
+		default:
+			err = c.evaluateDeclaration(ctx, n)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evaluateRule evaluates a rule and the statements within it.
+func (c *compiler) evaluateRule(ctx *context, n *node) error {
+	text, err := c.interpolate(ctx, n, n.text)
+	if err != nil {
+		return err
+	}
+
+	rule := &item{selectors: resolveSelectors(ctx.selectors, text)}
+	*ctx.out = append(*ctx.out, rule)
+
+	return c.evaluate(&context{
+		path:      ctx.path,
+		scope:     newScope(ctx.scope),
+		selectors: rule.selectors,
+		parent:    rule,
+		out:       ctx.out,
+	}, n.children)
+}
+
+// evaluateVariable evaluates the assignment of a variable.
+func (c *compiler) evaluateVariable(ctx *context, n *node) error {
+	parts := strings.SplitN(n.text, ":", 2)
+	if len(parts) != 2 {
+		return errorf(ctx, n, "expected : after variable name")
+	}
+
+	name := strings.TrimSpace(parts[0])
+	value := strings.TrimSpace(parts[1])
+	target := ctx.scope
+
+	for _, flag := range []string{"!global", "!default"} {
+		if strings.HasSuffix(value, flag) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, flag))
+			switch flag {
+			case "!global":
+				target = c.globals
+			case "!default":
+				if _, ok := ctx.scope.lookup(name); ok {
+					return nil
+				}
+			}
+		}
+	}
+
+	value, err := c.evaluateValue(ctx, n, value)
+	if err != nil {
+		return err
+	}
+
+	target.variables[name] = value
+	return nil
+}
+
+// evaluateDeclaration evaluates a declaration and adds it to the enclosing
+// rule. The values of custom properties are only interpolated.
+func (c *compiler) evaluateDeclaration(ctx *context, n *node) error {
+	if ctx.parent == nil {
+		return errorf(ctx, n, "declarations may only be used within a rule")
+	}
+
+	parts := strings.SplitN(n.text, ":", 2)
+	if len(parts) != 2 {
+		return errorf(ctx, n, "expected : in declaration %q", n.text)
+	}
+
+	name, err := c.interpolate(ctx, n, strings.TrimSpace(parts[0]))
+	if err != nil {
+		return err
+	}
+
+	value := strings.TrimSpace(parts[1])
+	if strings.HasPrefix(name, "--") {
+		value, err = c.interpolate(ctx, n, value)
+	} else {
+		value, err = c.evaluateValue(ctx, n, value)
+	}
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return errorf(ctx, n, "expected a value for %s", name)
+	}
+
+	ctx.parent.declarations = append(ctx.parent.declarations, name+": "+value)
+	return nil
+}
+
+// evaluateAtRule evaluates an at-rule, whether it is a Sass directive or is
+// passed through to the output.
+func (c *compiler) evaluateAtRule(ctx *context, n *node) error {
+	name := strings.Fields(n.text)[0]
+	args := strings.TrimSpace(strings.TrimPrefix(n.text, name))
+
+	for _, unsupported := range unsupportedRules {
+		if name == unsupported {
+			return errorf(ctx, n, "%s is not supported", name)
+		}
+	}
+
+	switch name {
+	case "@import":
+		return c.evaluateImport(ctx, n, args)
+	case "@mixin":
+		return c.evaluateMixin(ctx, n, args)
+	case "@include":
+		return c.evaluateInclude(ctx, n, args)
+	case "@extend":
+		if len(ctx.selectors) == 0 {
+			return errorf(ctx, n, "@extend may only be used within a rule")
+		}
+		target := strings.TrimSpace(strings.TrimSuffix(args, "!optional"))
+		for _, selector := range ctx.selectors {
+			c.extensions = append(c.extensions, extension{target: target, selector: selector})
+		}
+		return nil
+	case "@error":
+		message, err := c.evaluateValue(ctx, n, args)
+		if err != nil {
+			return err
+		}
+		return errorf(ctx, n, "%s", unquote(message))
+	case "@debug", "@warn":
+		return nil
+	}
+
+	prelude, err := c.evaluateValue(ctx, n, args)
+	if err != nil {
+		return err
+	}
+	rule := strings.TrimSpace(name + " " + prelude)
+
+	if !n.block {
+		if ctx.parent != nil || len(ctx.selectors) > 0 {
+			return errorf(ctx, n, "%s may only be used at the top level", name)
+		}
+		c.imports = append(c.imports, rule)
+		return nil
+	}
+
+	at := &item{rule: rule}
+	*ctx.out = append(*ctx.out, at)
+	inner := &context{path: ctx.path, scope: newScope(ctx.scope), parent: at, out: &at.children}
+
+	for _, conditional := range conditionalRules {
+		if name == conditional && len(ctx.selectors) > 0 {
+			// Declarations within the at-rule apply to the enclosing rule.
+			rule := &item{selectors: ctx.selectors}
+			at.children = append(at.children, rule)
+			inner.selectors = ctx.selectors
+			inner.parent = rule
+		}
+	}
+
+	return c.evaluate(inner, n.children)
+}
+
+// evaluateImport evaluates the stylesheets imported by an @import rule.
+// Imports of plain CSS files and URLs are passed through to the output.
+func (c *compiler) evaluateImport(ctx *context, n *node, args string) error {
+	if n.block {
+		return errorf(ctx, n, "@import may not have a block")
+	}
+
+	for _, arg := range splitList(args, ',') {
+		target := unquote(arg)
+		if target == arg || strings.HasSuffix(target, ".css") || strings.Contains(target, "://") {
+			if ctx.parent != nil || len(ctx.selectors) > 0 {
+				return errorf(ctx, n, "plain CSS imports may only be used at the top level")
+			}
+			c.imports = append(c.imports, "@import "+arg)
+			continue
+		}
+
+		name, err := c.resolveImport(ctx.path, target)
+		if err != nil {
+			return errorf(ctx, n, "%s", err)
+		}
+		if err := c.importFile(ctx, name, n.line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveImport returns the path of the stylesheet an import refers to.
+func (c *compiler) resolveImport(from, target string) (string, error) {
+	name := path.Join(path.Dir(from), target)
+	candidates := []string{name}
+	if path.Ext(name) != ".scss" {
+		candidates = []string{name + ".scss", path.Join(path.Dir(name), "_"+path.Base(name)+".scss")}
+	}
+
+	for _, candidate := range candidates {
+		if _, err := fs.Stat(c.fsys, candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find stylesheet %q to import", target)
+}
+
+// evaluateMixin defines a mixin.
+func (c *compiler) evaluateMixin(ctx *context, n *node, args string) error {
+	if !n.block {
+		return errorf(ctx, n, "@mixin must have a block")
+	}
+
+	match := callPattern.FindStringSubmatch(args)
+	if match == nil {
+		return errorf(ctx, n, "invalid mixin %q", args)
+	}
+
+	defined := &mixin{defaults: make(map[string]string), body: n.children, path: ctx.path}
+	if strings.TrimSpace(match[2]) != "" {
+		for _, param := range splitList(match[2], ',') {
+			parts := strings.SplitN(param, ":", 2)
+			name := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(name, "$") {
+				return errorf(ctx, n, "invalid parameter %q", param)
+			}
+			defined.params = append(defined.params, name)
+			if len(parts) == 2 {
+				defined.defaults[name] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	c.mixins[match[1]] = defined
+	return nil
+}
+
+// evaluateInclude evaluates the statements of a mixin where it is included.
+func (c *compiler) evaluateInclude(ctx *context, n *node, args string) error {
+	if n.block {
+		return errorf(ctx, n, "@include does not support content blocks")
+	}
+
+	match := callPattern.FindStringSubmatch(args)
+	if match == nil {
+		return errorf(ctx, n, "invalid include %q", args)
+	}
+
+	included, ok := c.mixins[match[1]]
+	if !ok {
+		return errorf(ctx, n, "undefined mixin %s", match[1])
+	}
+
+	arguments := newScope(c.globals)
+	if strings.TrimSpace(match[2]) != "" {
+		for i, arg := range splitList(match[2], ',') {
+			name := ""
+			if strings.HasPrefix(arg, "$") && strings.Contains(arg, ":") {
+				parts := strings.SplitN(arg, ":", 2)
+				name, arg = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			} else if i < len(included.params) {
+				name = included.params[i]
+			} else {
+				return errorf(ctx, n, "too many arguments to mixin %s", match[1])
+			}
+
+			value, err := c.evaluateValue(ctx, n, arg)
+			if err != nil {
+				return err
+			}
+			arguments.variables[name] = value
+		}
+	}
+
+	for _, param := range included.params {
+		if _, ok := arguments.variables[param]; ok {
+			continue
+		}
+		fallback, ok := included.defaults[param]
+		if !ok {
+			return errorf(ctx, n, "missing argument %s to mixin %s", param, match[1])
+		}
+		value, err := c.evaluateValue(&context{path: included.path, scope: arguments}, n, fallback)
+		if err != nil {
+			return err
+		}
+		arguments.variables[param] = value
+	}
+
+	inner := *ctx
+	inner.path = included.path
+	inner.scope = arguments
+	return c.evaluate(&inner, included.body)
+}
+
+// interpolate replaces every #{expression} in text with its value, unquoted.
+func (c *compiler) interpolate(ctx *context, n *node, text string) (string, error) {
+	var out strings.Builder
+	for {
+		start := strings.Index(text, "#{")
+		if start == -1 {
+			out.WriteString(text)
+			return out.String(), nil
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end == -1 {
+			return "", errorf(ctx, n, "unterminated interpolation")
+		}
+
+		value, err := c.evaluateValue(ctx, n, text[start+2:start+end])
+		if err != nil {
+			return "", err
+		}
+
+		out.WriteString(text[:start])
+		out.WriteString(unquote(value))
+		text = text[start+end+1:]
+	}
+}
+
+// evaluateValue returns a value with interpolation and variables replaced and
+// arithmetic between numbers separated by spaces carried out.
+func (c *compiler) evaluateValue(ctx *context, n *node, value string) (string, error) {
+	value, err := c.interpolate(ctx, n, value)
+	if err != nil {
+		return "", err
+	}
+
+	var undefined string
+	value = variablePattern.ReplaceAllStringFunc(value, func(name string) string {
+		resolved, ok := ctx.scope.lookup(name)
+		if !ok && undefined == "" {
+			undefined = name
+		}
+		return resolved
+	})
+	if undefined != "" {
+		return "", errorf(ctx, n, "undefined variable %s", undefined)
+	}
+
+	return arithmetic(value), nil
+}
+
+// arithmetic returns a value with the arithmetic between numbers separated by
+// spaces carried out, including within parentheses that are not part of a
+// function call such as calc().
+func arithmetic(value string) string {
+	tokens := splitList(value, ' ')
+	out := []string{}
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if strings.HasPrefix(token, "(") && strings.HasSuffix(token, ")") {
+			token = "(" + arithmetic(token[1:len(token)-1]) + ")"
+		}
+
+		if len(out) > 0 && i+1 < len(tokens) {
+			if result, ok := calculate(out[len(out)-1], token, tokens[i+1]); ok {
+				out[len(out)-1] = result
+				i++
+				continue
+			}
+		}
+		out = append(out, token)
+	}
+
+	return strings.Join(out, " ")
+}
+
+// calculate returns the result of adding, subtracting or multiplying two
+// numbers, if both are numbers and their units are compatible.
+func calculate(left, operator, right string) (string, bool) {
+	if operator != "+" && operator != "-" && operator != "*" {
+		return "", false
+	}
+
+	a, b := numberPattern.FindStringSubmatch(left), numberPattern.FindStringSubmatch(right)
+	if a == nil || b == nil {
+		return "", false
+	}
+
+	x, _ := strconv.ParseFloat(a[1], 64)
+	y, _ := strconv.ParseFloat(b[1], 64)
+	unit := a[2]
+	if unit == "" {
+		unit = b[2]
+	} else if b[2] != "" && b[2] != unit {
+		return "", false
+	}
+
+	var result float64
+	switch operator {
+	case "+":
+		result = x + y
+	case "-":
+		result = x - y
+	case "*":
+		if a[2] != "" && b[2] != "" {
+			return "", false
+		}
+		result = x * y
+	}
+
+	result = math.Round(result*1e10) / 1e10
+	return strconv.FormatFloat(result, 'f', -1, 64) + unit, true
+}
+
+// splitList splits text on a separator outside of strings and parentheses,
+// dropping empty parts and trimming whitespace from each.
+func splitList(text string, separator byte) []string {
+	parts := []string{}
+	depth := 0
+	var quote byte
+	start := 0
+
+	add := func(end int) {
+		if part := strings.TrimSpace(text[start:end]); part != "" {
+			parts = append(parts, part)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		switch {
+		case quote != 0:
+			if char == '\\' {
+				i++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '(' || char == '[':
+			depth++
+		case char == ')' || char == ']':
+			depth--
+		case depth == 0 && (char == separator || separator == ' ' && strings.IndexByte("\t\r\n", char) != -1):
+			add(i)
+		}
+	}
+	add(len(text))
+
+	return parts
+}
+
+// unquote returns a string without the quotes surrounding it, if any.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
+
+// resolveSelectors returns the selectors of a rule nested within rules with
+// the parent selectors given. Each selector is combined with every parent,
+// replacing & with the parent if it is used and otherwise treating the
+// selector as a descendant of the parent.
+func resolveSelectors(parents []string, text string) []string {
+	children := []string{}
+	for _, selector := range splitList(text, ',') {
+		children = append(children, strings.Join(strings.Fields(selector), " "))
+	}
+	if len(parents) == 0 {
+		return children
+	}
+
+	selectors := []string{}
+	for _, parent := range parents {
+		for _, selector := range children {
+			if strings.Contains(selector, "&") {
+				selectors = append(selectors, strings.Replace(selector, "&", parent, -1))
+			} else {
+				selectors = append(selectors, parent+" "+selector)
+			}
+		}
+	}
+
+	return selectors
+}
+
+// extend adds the selectors extending others to every rule using them, and
+// removes placeholder selectors from the output.
+func (c *compiler) extend(items []*item) {
+	for _, current := range items {
+		if current.selectors == nil {
+			c.extend(current.children)
+			continue
+		}
+
+		selectors := append([]string{}, current.selectors...)
+		seen := make(map[string]bool)
+		for _, selector := range selectors {
+			seen[selector] = true
+		}
+
+		for i := 0; i < len(selectors); i++ {
+			for _, ext := range c.extensions {
+				extended, ok := replaceSimple(selectors[i], ext.target, ext.selector)
+				if ok && !seen[extended] {
+					seen[extended] = true
+					selectors = append(selectors, extended)
+				}
+			}
+		}
+
+		current.selectors = []string{}
+		for _, selector := range selectors {
+			if !strings.Contains(selector, "%") {
+				current.selectors = append(current.selectors, selector)
+			}
+		}
+	}
+}
+
+// replaceSimple replaces the first use of a simple selector, such as a class
+// or placeholder, within a selector.
+func replaceSimple(selector, target, replacement string) (string, bool) {
+	for offset := 0; offset < len(selector); {
+		index := strings.Index(selector[offset:], target)
+		if index == -1 {
+			return "", false
+		}
+
+		start := offset + index
+		end := start + len(target)
+		if end == len(selector) || !isNameChar(selector[end]) {
+			return selector[:start] + replacement + selector[end:], true
+		}
+		offset = end
+	}
+
+	return "", false
+}
+
+// isNameChar returns true if the character may be part of a CSS identifier.
+func isNameChar(char byte) bool {
+	return char == '-' || char == '_' || char >= '0' && char <= '9' || char >= 'a' && char <= 'z' ||
+		char >= 'A' && char <= 'Z' || char >= 0x80
+}
+
+// renderItems returns the CSS of each rule and at-rule that is not empty.
+func renderItems(items []*item, prefix string) []string {
+	rendered := []string{}
+	for _, current := range items {
+		var out strings.Builder
+		if current.selectors != nil {
+			if len(current.selectors) == 0 || len(current.declarations) == 0 {
+				continue
+			}
+			out.WriteString(prefix + strings.Join(current.selectors, ",\n"+prefix) + " {\n")
+		} else {
+			children := renderItems(current.children, prefix+indent)
+			if len(children) == 0 && len(current.declarations) == 0 {
+				continue
+			}
+			out.WriteString(prefix + current.rule + " {\n")
+			for _, declaration := range current.declarations {
+				out.WriteString(prefix + indent + declaration + ";\n")
+			}
+			out.WriteString(strings.Join(children, ""))
+			out.WriteString(prefix + "}\n")
+			rendered = append(rendered, out.String())
+			continue
+		}
+
+		for _, declaration := range current.declarations {
+			out.WriteString(prefix + indent + declaration + ";\n")
+		}
+		out.WriteString(prefix + "}\n")
+		rendered = append(rendered, out.String())
+	}
+
+	return rendered
+}
@@ -0,0 +1,127 @@
+package scss
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/octacian/extensus/shared"
+)
+
+// TestCompile ensures that each supported feature compiles to the CSS Sass
+// would produce.
+func TestCompile(t *testing.T) {
+	files := fstest.MapFS{
+		"scss/_variables.scss": {Data: []byte("$width: 12rem;\n$time: 250ms !default;\n")},
+		"scss/index.scss": {Data: []byte(`@import "./variables";
+@import "https://example.com/font.css";
+
+// Line comments are removed.
+%center { display: flex; }
+
+@mixin theme($text, $background: white) {
+	--text: #{$text};
+	background: $background;
+}
+
+/* Block comments too. */
+.sidebar, .panel {
+	width: $width + 1rem;
+	transition: width $time - 100ms;
+	@include theme(black);
+
+	.item {
+		@extend %center;
+		a { color: red }
+	}
+
+	&:hover { opacity: 0.5; }
+
+	@media (max-width: $width * 2) {
+		width: 100%;
+	}
+}
+`)},
+	}
+
+	// Rules extending a placeholder take the place of its rule.
+	expected := `@import "https://example.com/font.css";
+
+.sidebar .item,
+.panel .item {
+  display: flex;
+}
+
+.sidebar,
+.panel {
+  width: 13rem;
+  transition: width 150ms;
+  --text: black;
+  background: white;
+}
+
+.sidebar .item a,
+.panel .item a {
+  color: red;
+}
+
+.sidebar:hover,
+.panel:hover {
+  opacity: 0.5;
+}
+
+@media (max-width: 24rem) {
+  .sidebar,
+  .panel {
+    width: 100%;
+  }
+}
+`
+
+	css, err := Compile(files, "scss/index.scss")
+	if err != nil {
+		t.Fatal("Compile: got error:\n", err)
+	}
+	if string(css) != expected {
+		t.Errorf("Compile: got:\n%s\nexpected:\n%s", css, expected)
+	}
+}
+
+// TestCompileErrors ensures that errors are reported with the stylesheet and
+// line they were found on.
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]int{
+		"a {\n\tcolor: $missing;\n}":    2,
+		"a {\n\tcolor: red;\n":          3,
+		"\n\n@import \"missing\";":      3,
+		"a {\n\t@include missing;\n}":   2,
+		"color: red;":                   1,
+		"@each $i in 1, 2 {\n\ta {}\n}": 1,
+	}
+
+	for source, line := range tests {
+		files := fstest.MapFS{"index.scss": {Data: []byte(source)}}
+		_, err := Compile(files, "index.scss")
+		if syntaxErr, ok := err.(*ErrSyntax); !ok {
+			t.Errorf("Compile(%q): expected ErrSyntax, got: %v", source, err)
+		} else if syntaxErr.Path != "index.scss" || syntaxErr.Line != line {
+			t.Errorf("Compile(%q): got error at %s:%d expected index.scss:%d", source, syntaxErr.Path,
+				syntaxErr.Line, line)
+		}
+	}
+}
+
+// TestCompileStylesheets ensures that the stylesheets shipped with the project
+// compile.
+func TestCompileStylesheets(t *testing.T) {
+	css, err := Compile(shared.Assets("public"), "scss/index.scss")
+	if err != nil {
+		t.Fatal("Compile: got error:\n", err)
+	}
+
+	for _, expected := range []string{"body {", ".sidebar .list .item,\nheader,", "left: 13rem;"} {
+		if !strings.Contains(string(css), expected) {
+			t.Errorf("Compile: expected output to contain %q, got:\n%s", expected, css)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Package static holds the files served under /public: the files in public
+// and the stylesheets compiled from public/scss. Each file is given a URL
+// holding a hash of its contents so that browsers can cache it indefinitely.
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/octacian/extensus/master/scss"
+	"github.com/octacian/extensus/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// hashLength is the number of hexadecimal digits of a hash used in URLs.
+	hashLength = 12
+
+	// reloadDelay is how long Watch waits after the last change to public
+	// before building again, so that saving several files builds only once.
+	reloadDelay = 100 * time.Millisecond
+)
+
+// fingerprintPattern matches paths with a hash inserted before the extension.
+var fingerprintPattern = regexp.MustCompile(`^(.+)\.([0-9a-f]{12})(\.[^./]+)?$`)
+
+var (
+	// built maps the path within public of each compiled stylesheet, such as
+	// css/index.css, to its contents.
+	built      map[string]*file
+	builtMutex sync.RWMutex
+	builtOnce  sync.Once
+
+	// hashes caches the hash of each file by its path within public.
+	hashes      = make(map[string]string)
+	hashesMutex sync.Mutex
+)
+
+// file is a file built by Build and held in memory.
+type file struct {
+	contents []byte
+	modTime  time.Time
+}
+
+// Build compiles every stylesheet in public/scss whose name does not begin
+// with an underscore into public/css, held in memory along with a gzipped
+// copy such as css/index.css.gz, and discards cached hashes. If any stylesheet
+// fails to compile the stylesheets built before are kept and the error is
+// returned.
+func Build() error {
+	public := shared.Assets("public")
+	names, err := fs.Glob(public, "scss/*.scss")
+	if err != nil {
+		return err
+	}
+
+	compiled := make(map[string]*file)
+	for _, name := range names {
+		base := path.Base(name)
+		if strings.HasPrefix(base, "_") {
+			continue
+		}
+
+		css, err := scss.Compile(public, name)
+		if err != nil {
+			return err
+		}
+		var gzipped bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&gzipped, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(css); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+
+		output := path.Join("css", strings.TrimSuffix(base, ".scss")+".css")
+		compiled[output] = &file{contents: css, modTime: shared.Time()}
+		compiled[output+".gz"] = &file{contents: gzipped.Bytes(), modTime: compiled[output].modTime}
+	}
+
+	builtMutex.Lock()
+	built = compiled
+	builtMutex.Unlock()
+
+	hashesMutex.Lock()
+	hashes = make(map[string]string)
+	hashesMutex.Unlock()
+
+	return nil
+}
+
+// getBuilt returns the compiled stylesheets, building them the first time it
+// is called. If they cannot be built panic is called.
+func getBuilt() map[string]*file {
+	builtOnce.Do(func() {
+		if err := Build(); err != nil {
+			log.Panic("static.getBuilt: got error:\n", err)
+		}
+	})
+
+	builtMutex.RLock()
+	defer builtMutex.RUnlock()
+	return built
+}
+
+// FS returns a file system rooted at public, read from the asset directory if
+// one is set or from the embedded copies otherwise, which also holds the
+// stylesheets compiled by Build.
+func FS() fs.FS {
+	return overlay{public: shared.Assets("public"), built: getBuilt()}
+}
+
+// Hash returns the hash of the contents of a file in public or of a compiled
+// stylesheet. Hashes are cached until Build is called again. Returns false if
+// the file does not exist.
+func Hash(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "/")
+
+	hashesMutex.Lock()
+	hash, ok := hashes[name]
+	hashesMutex.Unlock()
+	if ok {
+		return hash, true
+	}
+
+	contents, err := fs.ReadFile(FS(), name)
+	if err != nil {
+		return "", false
+	}
+
+	sum := sha256.Sum256(contents)
+	hash = hex.EncodeToString(sum[:])[:hashLength]
+
+	hashesMutex.Lock()
+	hashes[name] = hash
+	hashesMutex.Unlock()
+
+	return hash, true
+}
+
+// URL returns the URL path of a file in public with the hash of its contents
+// inserted before its extension, e.g. /public/css/index.0123456789ab.css, so
+// that the URL changes whenever the file does. If the file does not exist,
+// such as a stylesheet that failed to build, its URL is returned without a
+// hash.
+func URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	hash, ok := Hash(name)
+	if !ok {
+		return "/public/" + name
+	}
+
+	extension := path.Ext(name)
+	return "/public/" + strings.TrimSuffix(name, extension) + "." + hash + extension
+}
+
+// Lookup returns the path within public of the file a request path refers to,
+// with the hash removed if it was given one by URL, along with the hash of
+// the current contents of the file. The last value is true only if the
+// request path held the current hash, in which case the response will never
+// change. The hash is empty if the file does not exist.
+func Lookup(name string) (string, string, bool) {
+	name = strings.TrimPrefix(name, "/")
+	if match := fingerprintPattern.FindStringSubmatch(name); match != nil {
+		if hash, ok := Hash(match[1] + match[3]); ok {
+			return match[1] + match[3], hash, hash == match[2]
+		}
+	}
+
+	hash, _ := Hash(name)
+	return name, hash, false
+}
+
+// watchDirectory adds a directory and all of its sub-directories to the
+// watcher.
+func watchDirectory(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.IsDir() {
+			return watcher.Add(path)
+		}
+
+		return nil
+	})
+}
+
+// Watch watches the public directory and its sub-directories, including those
+// created later, for changes and builds again once changes have stopped for
+// reloadDelay, until the context is done. Files can only be watched if an
+// asset directory is set. If the watcher cannot be started panic is called.
+func Watch(ctx context.Context) {
+	if shared.AssetDirectory() == "" {
+		log.Warn("static.Watch: static files are embedded in the binary, set an asset directory to rebuild them")
+		return
+	}
+	publicPath := filepath.Join(shared.AssetDirectory(), "public")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Panic("static.Watch: got error while creating watcher:\n", err)
+	}
+	defer watcher.Close()
+
+	if err := watchDirectory(watcher, publicPath); err != nil {
+		log.Panic("static.Watch: got error while walking public directory:\n", err)
+	}
+
+	// The timer is stopped until the first change is seen.
+	timer := time.NewTimer(reloadDelay)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	log.Info("Started static file watcher")
+	for {
+		select {
+		case event := <-watcher.Events:
+			if event.Op&fsnotify.Create != 0 {
+				if file, err := os.Stat(event.Name); err == nil && file.IsDir() {
+					if err := watchDirectory(watcher, event.Name); err != nil {
+						log.Warn("static.Watch: got error while watching new directory:\n", err)
+					}
+				}
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(reloadDelay)
+		case <-timer.C:
+			log.Info("Static files changed, building again")
+			if err := Build(); err != nil {
+				log.Error("static.Watch: keeping previous stylesheets after error:\n", err)
+			}
+		case err := <-watcher.Errors:
+			log.Warn("static.Watch: got error:", err)
+		case <-ctx.Done():
+			log.Info("Stopped static file watcher")
+			return
+		}
+	}
+}
+
+// overlay is a file system holding the compiled stylesheets over public.
+type overlay struct {
+	public fs.FS
+	built  map[string]*file
+}
+
+// Open implements fs.FS for overlay.
+func (o overlay) Open(name string) (fs.File, error) {
+	if built, ok := o.built[name]; ok {
+		return &memoryFile{
+			Reader: bytes.NewReader(built.contents),
+			info:   fileInfo{name: path.Base(name), size: int64(len(built.contents)), modTime: built.modTime},
+		}, nil
+	}
+
+	return o.public.Open(name)
+}
+
+// memoryFile is an fs.File reading from memory. It can seek so that it can be
+// served with http.FileServer.
+type memoryFile struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+// Stat implements fs.File for memoryFile.
+func (file *memoryFile) Stat() (fs.FileInfo, error) {
+	return file.info, nil
+}
+
+// Close implements fs.File for memoryFile.
+func (file *memoryFile) Close() error {
+	return nil
+}
+
+// fileInfo describes a memoryFile.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (info fileInfo) Name() string       { return info.name }
+func (info fileInfo) Size() int64        { return info.size }
+func (info fileInfo) Mode() fs.FileMode  { return 0444 }
+func (info fileInfo) ModTime() time.Time { return info.modTime }
+func (info fileInfo) IsDir() bool        { return false }
+func (info fileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,54 @@
+package static
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// TestBuild ensures that stylesheets are compiled into public/css and that
+// partials are not.
+func TestBuild(t *testing.T) {
+	if err := Build(); err != nil {
+		t.Fatal("Build: got error:\n", err)
+	}
+
+	css, err := fs.ReadFile(FS(), "css/index.css")
+	if err != nil {
+		t.Fatal("fs.ReadFile: got error:\n", err)
+	} else if !strings.Contains(string(css), "body {") {
+		t.Errorf("Build: expected css/index.css to be compiled, got:\n%s", css)
+	}
+
+	if _, err := fs.Stat(FS(), "css/_interface.css"); err == nil {
+		t.Error("Build: expected partial _interface.scss not to be compiled")
+	}
+}
+
+// TestLookup ensures that the paths given by URL are resolved to the files
+// they refer to and that only paths holding the current hash are current.
+func TestLookup(t *testing.T) {
+	hash, ok := Hash("css/index.css")
+	if !ok {
+		t.Fatal("Hash: css/index.css does not exist")
+	}
+
+	stale := strings.Repeat("0", hashLength)
+	tests := []struct {
+		request, file, hash string
+		current             bool
+	}{
+		{strings.TrimPrefix(URL("css/index.css"), "/public/"), "css/index.css", hash, true},
+		{"css/index." + stale + ".css", "css/index.css", hash, false},
+		{"css/index.css", "css/index.css", hash, false},
+		{"css/missing." + stale + ".css", "css/missing." + stale + ".css", "", false},
+	}
+
+	for _, test := range tests {
+		file, hash, current := Lookup(test.request)
+		if file != test.file || hash != test.hash || current != test.current {
+			t.Errorf("Lookup(%q): got (%s, %s, %t) expected (%s, %s, %t)", test.request, file, hash, current,
+				test.file, test.hash, test.current)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package template
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/octacian/extensus/master/core"
+)
+
+// validColor matches the CSS hex colors accepted as the primary color, which
+// cannot break out of the style element they are written into.
+var validColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// Brand holds the branding configured for the web interface. It is passed to
+// every template as Brand.
+type Brand struct {
+	Name         string
+	Logo         string       // URL of the logo, empty if none is configured
+	PrimaryColor template.CSS // empty to keep the color set by the stylesheet
+}
+
+// currentBrand returns the branding in the configuration. A logo given as a
+// path within public is served with asset, and a primary color that is not a
+// CSS hex color is ignored.
+func currentBrand() Brand {
+	branding := core.GetConfig().Branding
+	brand := Brand{Name: core.GetConfig().BrandName(), Logo: branding.Logo}
+
+	if brand.Logo != "" && !strings.HasPrefix(brand.Logo, "/") && !strings.Contains(brand.Logo, "://") {
+		brand.Logo = asset(brand.Logo)
+	}
+
+	if validColor.MatchString(branding.PrimaryColor) {
+		brand.PrimaryColor = template.CSS(branding.PrimaryColor)
+	}
+
+	return brand
+}
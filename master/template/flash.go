@@ -0,0 +1,35 @@
+package template
+
+import "context"
+
+const (
+	FlashSuccess = "success" // kind of flash confirming that something was done
+	FlashFailure = "failure" // kind of flash explaining why something was not done
+)
+
+// contextKey is an unexported type for keys defined in this package for use
+// with context.WithValue.
+type contextKey int
+
+// flashesContextKey is the key for the flashes of a request in Contexts.
+// Clients must use NewFlashContext and FlashesFromContext.
+var flashesContextKey contextKey
+
+// Flash is a message shown once on the next page rendered, usually after a
+// redirect. Its kind is used as part of its CSS class, e.g. form-success.
+type Flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// FlashesFromContext returns the flashes stored in a context, if any.
+func FlashesFromContext(ctx context.Context) []Flash {
+	flashes, _ := ctx.Value(flashesContextKey).([]Flash)
+	return flashes
+}
+
+// NewFlashContext returns a new context.Context that carries flashes to be
+// shown by Render.
+func NewFlashContext(parent context.Context, flashes []Flash) context.Context {
+	return context.WithValue(parent, flashesContextKey, flashes)
+}
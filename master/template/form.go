@@ -0,0 +1,70 @@
+package template
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/models"
+)
+
+// Form holds the values submitted with a form and the errors found in them so
+// that every form renders errors the same way: field errors with the
+// partials/field-error template and the failure of the form as a whole with
+// partials/messages. It is passed to templates as Form.
+type Form struct {
+	Values  url.Values
+	Errors  map[string]string // maps field names to error messages
+	Failure string            // optional error concerning the form as a whole
+	locale  *i18n.Locale      // locale error messages are shown in
+}
+
+// NewForm returns a Form holding the values submitted with a request, which
+// shows errors in the locale of the request.
+func NewForm(r *http.Request) *Form {
+	if r.Form == nil {
+		r.ParseForm()
+	}
+
+	return &Form{Values: r.Form, Errors: make(map[string]string), locale: i18n.FromContext(r.Context())}
+}
+
+// Value returns the value submitted for a field.
+func (form *Form) Value(field string) string {
+	return form.Values.Get(field)
+}
+
+// Error returns the error message of a field or an empty string if it is
+// valid.
+func (form *Form) Error(field string) string {
+	return form.Errors[field]
+}
+
+// Valid returns true if no errors have been found.
+func (form *Form) Valid() bool {
+	return len(form.Errors) == 0 && form.Failure == ""
+}
+
+// Invalidate records an error message for a field, replacing any recorded
+// before.
+func (form *Form) Invalidate(field, message string) {
+	form.Errors[field] = message
+}
+
+// Fail records an error concerning the form as a whole.
+func (form *Form) Fail(message string) {
+	form.Failure = message
+}
+
+// AddError records the field error described by an ErrInvalid, translated
+// into the locale of the form, and returns true. Any other error is left for
+// the caller to handle and false is returned.
+func (form *Form) AddError(err error) bool {
+	invalid, ok := err.(*models.ErrInvalid)
+	if !ok {
+		return false
+	}
+
+	form.Invalidate(invalid.Which, invalid.Localize(form.locale))
+	return true
+}
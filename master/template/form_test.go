@@ -0,0 +1,55 @@
+package template
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/octacian/extensus/master/models"
+)
+
+// TestFormAddError ensures that ErrInvalid values are recorded as messages on
+// the field they concern and that other errors are left to the caller.
+func TestFormAddError(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("name=Jane&email=jane"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form := NewForm(r)
+
+	if got := form.Value("email"); got != "jane" {
+		t.Errorf("Form.Value: got '%s' expected 'jane'", got)
+	}
+	if !form.Valid() {
+		t.Error("Form.Valid: expected a new form to be valid")
+	}
+
+	tests := []struct {
+		err      *models.ErrInvalid
+		expected string
+	}{
+		{&models.ErrInvalid{Model: "user", Which: "email", Value: "jane"}, "Invalid email address"},
+		{&models.ErrInvalid{Model: "user", Which: "name"}, "Name cannot be blank"},
+		{&models.ErrInvalid{Model: "user", Which: "timezone", Value: "Mars/Base"}, "Unknown timezone"},
+		{&models.ErrInvalid{Model: "user", Which: "nickname", Value: "x"}, "nickname is not valid"},
+		{&models.ErrInvalid{Model: "user", Which: "password", Reason: "must be at least 1 characters",
+			Code: "tooShort", Args: []interface{}{1}}, "Password must be at least 1 character"},
+		{&models.ErrInvalid{Model: "user", Which: "password", Reason: "has been used recently"},
+			"Password has been used recently"},
+		{&models.ErrInvalid{Model: "user", Which: "confirmPassword"}, "Passwords do not match"},
+	}
+
+	for _, test := range tests {
+		if !form.AddError(test.err) {
+			t.Errorf("Form.AddError(%s): expected the error to be recorded", test.err)
+		} else if got := form.Error(test.err.Which); got != test.expected {
+			t.Errorf("Form.AddError(%s): got message '%s' expected '%s'", test.err, got, test.expected)
+		}
+	}
+
+	if form.AddError(errors.New("database is down")) {
+		t.Error("Form.AddError: expected other errors not to be recorded")
+	}
+	if form.Valid() {
+		t.Error("Form.Valid: expected a form with errors to be invalid")
+	}
+}
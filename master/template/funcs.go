@@ -0,0 +1,290 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/static"
+	"github.com/octacian/extensus/shared"
+)
+
+// defaultDateLayout is used by datetime when no layout is given.
+const defaultDateLayout = "2006-01-02 15:04"
+
+// funcs holds the functions available to every template.
+var funcs = template.FuncMap{
+	"datetime": datetime,
+	"ago":      ago,
+	"bytes":    bytes,
+	"duration": duration,
+	"plural":   plural,
+	"url":      routeURL,
+	"json":     toJSON,
+	"asset":    asset,
+	"t":        translate,
+}
+
+var (
+	// namedRoutes maps route names to the patterns registered by NamedRoute.
+	namedRoutes      = make(map[string]string)
+	namedRoutesMutex sync.RWMutex
+)
+
+// NamedRoute records the pattern of a route under a name so that templates can
+// build URLs to it with the url function, and returns the pattern.
+func NamedRoute(name, pattern string) string {
+	namedRoutesMutex.Lock()
+	defer namedRoutesMutex.Unlock()
+
+	namedRoutes[name] = pattern
+	return pattern
+}
+
+// toTime converts a time.Time or *time.Time into a time.Time. Returns false if
+// the value is a nil pointer or the zero time.
+func toTime(value interface{}) (time.Time, bool) {
+	switch value := value.(type) {
+	case time.Time:
+		return value, !value.IsZero()
+	case *time.Time:
+		if value == nil {
+			return time.Time{}, false
+		}
+		return *value, !value.IsZero()
+	default:
+		return time.Time{}, false
+	}
+}
+
+// toInt64 converts any integer or float value into an int64.
+func toInt64(value interface{}) (int64, error) {
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflected.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(reflected.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(reflected.Float()), nil
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+}
+
+// datetime formats a time in a location using a time.Time.Format layout, such
+// as the Location and DateLayout passed to every template for logged in users.
+// A nil location means UTC and an empty layout the ISO date format. Nil and
+// zero times are formatted as an empty string.
+func datetime(value interface{}, location *time.Location, layout string) string {
+	t, ok := toTime(value)
+	if !ok {
+		return ""
+	}
+	if location == nil {
+		location = time.UTC
+	}
+	if layout == "" {
+		layout = defaultDateLayout
+	}
+
+	return t.In(location).Format(layout)
+}
+
+// ago describes how long ago or how far in the future a time is in a locale,
+// such as "5 minutes ago" or "in 2 days" in English. Nil and zero times are
+// described as an empty string. A nil locale means the default locale.
+func ago(locale *i18n.Locale, value interface{}) string {
+	t, ok := toTime(value)
+	if !ok {
+		return ""
+	}
+
+	return relativeTime(locale, t, shared.Time())
+}
+
+// relativeTime describes a time relative to now in a locale.
+func relativeTime(locale *i18n.Locale, t, now time.Time) string {
+	difference := now.Sub(t)
+	future := difference < 0
+	if future {
+		difference = -difference
+	}
+
+	if difference < time.Minute {
+		return translate(locale, "time.justNow")
+	}
+
+	units := []struct {
+		key  string
+		size time.Duration
+	}{
+		{"time.years", 365 * 24 * time.Hour},
+		{"time.months", 30 * 24 * time.Hour},
+		{"time.weeks", 7 * 24 * time.Hour},
+		{"time.days", 24 * time.Hour},
+		{"time.hours", time.Hour},
+		{"time.minutes", time.Minute},
+	}
+
+	var description string
+	for _, unit := range units {
+		if difference >= unit.size {
+			description = translate(locale, unit.key, int64(difference/unit.size))
+			break
+		}
+	}
+
+	if future {
+		return translate(locale, "time.in", description)
+	}
+	return translate(locale, "time.ago", description)
+}
+
+// bytes describes a number of bytes in a locale using binary units, such as
+// "1.5 KiB". A nil locale means the default locale.
+func bytes(locale *i18n.Locale, value interface{}) (string, error) {
+	size, err := toInt64(value)
+	if err != nil {
+		return "", fmt.Errorf("bytes: %s", err)
+	}
+
+	if size < 1024 && size > -1024 {
+		return translate(locale, "unit.bytes", size), nil
+	}
+
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	scaled := float64(size)
+	unit := -1
+	for math.Abs(scaled) >= 1024 && unit < len(units)-1 {
+		scaled /= 1024
+		unit++
+	}
+
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", scaled), ".0") + " " + units[unit], nil
+}
+
+// duration describes a duration using its two largest units, such as
+// "2h 5m" or "45s". Durations under a second are described exactly.
+func duration(value time.Duration) string {
+	if value < 0 {
+		return "-" + duration(-value)
+	}
+
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	for i, unit := range units {
+		if value < unit.size {
+			continue
+		}
+
+		description := fmt.Sprintf("%d%s", value/unit.size, unit.suffix)
+		if i+1 < len(units) {
+			next := units[i+1]
+			if remainder := value % unit.size / next.size; remainder > 0 {
+				description += fmt.Sprintf(" %d%s", remainder, next.suffix)
+			}
+		}
+		return description
+	}
+
+	return value.String()
+}
+
+// plural returns the message with the key given in a locale for a count, using
+// the plural rules of the locale to choose its form, such as
+// {{plural .Locale 3 "time.days"}} for "3 days" in English. A nil locale means
+// the default locale.
+func plural(locale *i18n.Locale, count interface{}, key string) (string, error) {
+	n, err := toInt64(count)
+	if err != nil {
+		return "", fmt.Errorf("plural: %s", err)
+	}
+
+	return translate(locale, key, n), nil
+}
+
+// translate returns the message with the key given in a locale, formatted with
+// the arguments as with fmt.Sprintf, such as {{t .Locale "login.submit"}}. If
+// the message has plural forms the first argument is the count used to choose
+// between them. A nil locale means the default locale.
+func translate(locale *i18n.Locale, key string, args ...interface{}) string {
+	if locale == nil {
+		locale = i18n.Default()
+	}
+
+	return locale.T(key, args...)
+}
+
+// routeURL builds the path of a route registered with NamedRoute. Arguments
+// after the name are pairs of URL parameter names and values, such as
+// {{url "avatar" "id" .User.ID}}. Pairs that do not match a parameter in the
+// pattern are added to the query string.
+func routeURL(name string, pairs ...interface{}) (string, error) {
+	namedRoutesMutex.RLock()
+	pattern, ok := namedRoutes[name]
+	namedRoutesMutex.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("url: no route named %s", name)
+	}
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("url: expected pairs of parameter names and values, got %d arguments", len(pairs))
+	}
+
+	query := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("url: expected parameter name to be a string, got %T", pairs[i])
+		}
+
+		value := fmt.Sprint(pairs[i+1])
+		placeholder := "{" + key + "}"
+		if strings.Contains(pattern, placeholder) {
+			pattern = strings.Replace(pattern, placeholder, url.PathEscape(value), -1)
+		} else {
+			query.Add(key, value)
+		}
+	}
+
+	if strings.Contains(pattern, "{") {
+		return "", fmt.Errorf("url: missing parameters for route %s: %s", name, pattern)
+	}
+	if len(query) > 0 {
+		pattern += "?" + query.Encode()
+	}
+
+	return pattern, nil
+}
+
+// toJSON encodes a value as JSON that is safe to embed in a script element.
+func toJSON(value interface{}) (template.JS, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("json: %s", err)
+	}
+
+	return template.JS(data), nil
+}
+
+// asset returns the URL path of a file in public, including compiled
+// stylesheets such as css/index.css, with a hash of its contents inserted so
+// that browsers fetch it again whenever it changes. See static.URL.
+func asset(path string) string {
+	return static.URL(path)
+}
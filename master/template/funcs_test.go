@@ -0,0 +1,213 @@
+package template
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/octacian/extensus/master/i18n"
+)
+
+// TestDatetime ensures that times are formatted in the location and layout
+// given.
+func TestDatetime(t *testing.T) {
+	moment := time.Date(2019, 7, 4, 18, 30, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal("time.LoadLocation: got error:\n", err)
+	}
+
+	tests := []struct {
+		value    interface{}
+		location *time.Location
+		layout   string
+		expected string
+	}{
+		{moment, nil, "", "2019-07-04 18:30"},
+		{moment, newYork, "", "2019-07-04 14:30"},
+		{&moment, newYork, "January 2, 2006 at 3:04 PM", "July 4, 2019 at 2:30 PM"},
+		{(*time.Time)(nil), nil, "", ""},
+		{time.Time{}, nil, "", ""},
+	}
+
+	for _, test := range tests {
+		if got := datetime(test.value, test.location, test.layout); got != test.expected {
+			t.Errorf("datetime(%v, %v, %q): got '%s' expected '%s'", test.value, test.location, test.layout, got,
+				test.expected)
+		}
+	}
+}
+
+// TestRelativeTime ensures that times are described relative to now in the
+// language of a locale.
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2019, 7, 4, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		locale   string
+		offset   time.Duration
+		expected string
+	}{
+		{"en", -10 * time.Second, "just now"},
+		{"en", -time.Minute, "1 minute ago"},
+		{"en", -150 * time.Minute, "2 hours ago"},
+		{"en", 3 * 24 * time.Hour, "in 3 days"},
+		{"en", -14 * 24 * time.Hour, "2 weeks ago"},
+		{"en", -400 * 24 * time.Hour, "1 year ago"},
+		{"en", 45 * 24 * time.Hour, "in 1 month"},
+		{"en", time.Hour + time.Second, "in 1 hour"},
+		{"es", -10 * time.Second, "justo ahora"},
+		{"es", -time.Minute, "hace 1 minuto"},
+		{"es", 3 * 24 * time.Hour, "dentro de 3 días"},
+		{"es", -400 * 24 * time.Hour, "hace 1 año"},
+	}
+
+	for _, test := range tests {
+		locale, ok := i18n.Get(test.locale)
+		if !ok {
+			t.Fatalf("i18n.Get(%s): locale not found", test.locale)
+		}
+
+		if got := relativeTime(locale, now.Add(test.offset), now); got != test.expected {
+			t.Errorf("relativeTime(%s, %s): got '%s' expected '%s'", test.locale, test.offset, got, test.expected)
+		}
+	}
+}
+
+// TestBytes ensures that sizes are described using binary units.
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{1, "1 byte"},
+		{int64(1023), "1023 bytes"},
+		{uint(1024), "1 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5 MiB"},
+	}
+
+	for _, test := range tests {
+		if got, err := bytes(nil, test.value); err != nil {
+			t.Errorf("bytes(%v): got error:\n%s", test.value, err)
+		} else if got != test.expected {
+			t.Errorf("bytes(%v): got '%s' expected '%s'", test.value, got, test.expected)
+		}
+	}
+
+	if _, err := bytes(nil, "1024"); err == nil {
+		t.Error("bytes(\"1024\"): expected error")
+	}
+}
+
+// TestDuration ensures that durations are described using their two largest
+// units.
+func TestDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		45 * time.Second:                "45s",
+		90 * time.Second:                "1m 30s",
+		2 * time.Hour:                   "2h",
+		2*time.Hour + 5*time.Minute + 9: "2h 5m",
+		26 * time.Hour:                  "1d 2h",
+		-90 * time.Second:               "-1m 30s",
+		250 * time.Millisecond:          "250ms",
+	}
+
+	for value, expected := range tests {
+		if got := duration(value); got != expected {
+			t.Errorf("duration(%d): got '%s' expected '%s'", value, got, expected)
+		}
+	}
+}
+
+// TestPlural ensures that the form of a message is chosen by the plural rules
+// of the locale.
+func TestPlural(t *testing.T) {
+	spanish, _ := i18n.Get("es")
+	tests := []struct {
+		locale   *i18n.Locale
+		count    interface{}
+		expected string
+	}{
+		{nil, 1, "1 day"},
+		{nil, 0, "0 days"},
+		{nil, uint64(3), "3 days"},
+		{spanish, 1, "1 día"},
+		{spanish, 2, "2 días"},
+	}
+
+	for _, test := range tests {
+		if got, err := plural(test.locale, test.count, "time.days"); err != nil {
+			t.Errorf("plural(%v): got error:\n%s", test.count, err)
+		} else if got != test.expected {
+			t.Errorf("plural(%v): got '%s' expected '%s'", test.count, got, test.expected)
+		}
+	}
+
+	if _, err := plural(nil, "3", "time.days"); err == nil {
+		t.Error("plural(\"3\"): expected error")
+	}
+}
+
+// TestRouteURL ensures that URLs are built from named routes.
+func TestRouteURL(t *testing.T) {
+	NamedRoute("testAvatar", "/test/avatar/{id}")
+
+	tests := []struct {
+		pairs    []interface{}
+		expected string
+	}{
+		{[]interface{}{"id", 5}, "/test/avatar/5"},
+		{[]interface{}{"id", "a b", "size", 64}, "/test/avatar/a%20b?size=64"},
+	}
+
+	for _, test := range tests {
+		if got, err := routeURL("testAvatar", test.pairs...); err != nil {
+			t.Errorf("routeURL(%v): got error:\n%s", test.pairs, err)
+		} else if got != test.expected {
+			t.Errorf("routeURL(%v): got '%s' expected '%s'", test.pairs, got, test.expected)
+		}
+	}
+
+	for _, pairs := range [][]interface{}{{}, {"id"}, {5, 5}} {
+		if _, err := routeURL("testAvatar", pairs...); err == nil {
+			t.Errorf("routeURL(%v): expected error", pairs)
+		}
+	}
+	if _, err := routeURL("testMissing"); err == nil {
+		t.Error("routeURL(\"testMissing\"): expected error")
+	}
+}
+
+// TestToJSON ensures that JSON cannot close the script element it is embedded
+// in.
+func TestToJSON(t *testing.T) {
+	got, err := toJSON(map[string]string{"name": "</script><script>alert(1)</script>"})
+	if err != nil {
+		t.Fatal("toJSON: got error:\n", err)
+	}
+
+	expected := `{"name":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"}`
+	if string(got) != expected {
+		t.Errorf("toJSON: got '%s' expected '%s'", got, expected)
+	}
+}
+
+// TestAsset ensures that static files, including compiled stylesheets, are
+// given a URL holding a hash of their contents and that missing files are
+// not.
+func TestAsset(t *testing.T) {
+	tests := map[string]*regexp.Regexp{
+		"css/index.css":    regexp.MustCompile(`^/public/css/index\.[0-9a-f]{12}\.css$`),
+		"/scss/index.scss": regexp.MustCompile(`^/public/scss/index\.[0-9a-f]{12}\.scss$`),
+	}
+
+	for name, expected := range tests {
+		if got := asset(name); !expected.MatchString(got) {
+			t.Errorf("asset(%q): got '%s' expected a URL matching %s", name, got, expected)
+		}
+	}
+
+	if got := asset("missing.css"); got != "/public/missing.css" {
+		t.Errorf("asset(\"missing.css\"): got '%s' expected '/public/missing.css'", got)
+	}
+}
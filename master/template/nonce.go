@@ -0,0 +1,21 @@
+package template
+
+import "context"
+
+// nonceContextKey is the key for the Content-Security-Policy nonce of a
+// request in Contexts. Clients must use NewNonceContext and NonceFromContext.
+var nonceContextKey contextKey = 1
+
+// NonceFromContext returns the Content-Security-Policy nonce stored in a
+// context, or an empty string if there is none.
+func NonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceContextKey).(string)
+	return nonce
+}
+
+// NewNonceContext returns a new context.Context that carries the nonce which
+// inline scripts and styles must be given to be allowed by the
+// Content-Security-Policy of the response.
+func NewNonceContext(parent context.Context, nonce string) context.Context {
+	return context.WithValue(parent, nonceContextKey, nonce)
+}
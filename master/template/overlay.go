@@ -0,0 +1,111 @@
+package template
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/octacian/extensus/shared"
+	log "github.com/sirupsen/logrus"
+)
+
+// overlayContext is the number of lines shown before and after the line an
+// error was found on.
+const overlayContext = 5
+
+// overlay is the page shown in development mode in place of every page while
+// the templates fail to parse. It is kept here rather than in the templates
+// directory so that it can be shown no matter what state the templates are in.
+var overlay = template.Must(template.New("overlay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Template Error | Extensus</title>
+	<style nonce="{{.Nonce}}">
+		body { margin: 0; padding: 2em; font-family: sans-serif; background: #2b2b2b; color: #eee; }
+		h1 { margin-top: 0; color: #ff6b6b; font-size: 1.5em; }
+		.location { font-family: monospace; color: #aaa; }
+		.message { padding: 1em; background: #3a2020; border-left: 4px solid #ff6b6b; font-family: monospace; white-space: pre-wrap; }
+		.source { margin-top: 1em; padding: 1em 0; background: #1e1e1e; font-family: monospace; overflow-x: auto; }
+		.source div { padding: 0 1em; white-space: pre; }
+		.source .current { background: #5a2a2a; }
+		.source .number { display: inline-block; width: 4em; color: #777; user-select: none; }
+	</style>
+</head>
+<body>
+	<h1>Templates failed to parse</h1>
+	<p class="location">{{.Path}}{{if .Line}}:{{.Line}}{{end}}</p>
+	<div class="message">{{.Message}}</div>
+	{{if .Source}}
+	<div class="source">
+		{{range .Source}}<div{{if .Current}} class="current"{{end}}><span class="number">{{.Number}}</span>{{.Text}}</div>
+		{{end}}
+	</div>
+	{{end}}
+	<p>The last templates that parsed are still loaded and will be served again once this error is fixed.</p>
+</body>
+</html>
+`))
+
+// sourceLine is a line of a template file shown in the error overlay.
+type sourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// sourceExcerpt returns the lines of a template file surrounding a line, or
+// nil if the file cannot be read or no line is given.
+func sourceExcerpt(path string, line int) []sourceLine {
+	if line < 1 {
+		return nil
+	}
+
+	contents, err := fs.ReadFile(shared.Assets("templates"), path)
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(string(contents), "\n")
+	first, last := line-overlayContext, line+overlayContext
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	excerpt := []sourceLine{}
+	for number := first; number <= last; number++ {
+		excerpt = append(excerpt, sourceLine{
+			Number:  number,
+			Text:    lines[number-1],
+			Current: number == line,
+		})
+	}
+
+	return excerpt
+}
+
+// renderOverlay writes a page describing an error that occurred while
+// reloading templates, including the lines surrounding it if it is an
+// ErrParse.
+func renderOverlay(w http.ResponseWriter, r *http.Request, err error) {
+	data := struct {
+		ErrParse
+		Source []sourceLine
+		Nonce  string
+	}{ErrParse: ErrParse{Message: err.Error()}, Nonce: NonceFromContext(r.Context())}
+
+	if parseErr, ok := err.(*ErrParse); ok {
+		data.ErrParse = *parseErr
+		data.Source = sourceExcerpt(parseErr.Path, parseErr.Line)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	if err := overlay.Execute(w, data); err != nil {
+		log.Error("template.renderOverlay: got error:\n", err)
+	}
+}
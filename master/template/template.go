@@ -1,25 +1,51 @@
 package template
 
 import (
+	"context"
+	"fmt"
 	"html/template"
-
-	"github.com/octacian/extensus/master/models"
-	"github.com/octacian/extensus/shared"
-
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/octacian/extensus/master/i18n"
+	"github.com/octacian/extensus/master/models"
+	"github.com/octacian/extensus/shared"
 	log "github.com/sirupsen/logrus"
+)
 
-	"github.com/fsnotify/fsnotify"
+const (
+	layoutDirectory  = "layouts"  // directory holding layouts that pages are rendered within
+	partialDirectory = "partials" // directory holding templates included by layouts and pages
+	defaultLayout    = "base"     // layout used by pages that do not declare one
+
+	// reloadDelay is how long WatchAll waits after the last change to a
+	// template before reloading, so that a burst of changes reloads once.
+	reloadDelay = 100 * time.Millisecond
 )
 
+// layoutDirective matches the comment at the start of a page declaring the
+// layout it is rendered within, e.g. {{/* layout: interface */}}.
+var layoutDirective = regexp.MustCompile(`^\s*\{\{/\*\s*layout:\s*([\w/-]+)\s*\*/\}\}`)
+
 var (
-	templates    = template.New("")
-	templatePath = shared.Abs("templates")
+	// pages maps the name of every page to the page itself. It is replaced as a
+	// whole whenever templates are reloaded.
+	pages = make(map[string]*Page)
+
+	// reloadError holds the error the last reload failed with, if any, while
+	// the pages loaded before it continue to be served.
+	reloadError error
+
+	pagesMutex sync.RWMutex
 )
 
 type (
@@ -29,112 +55,356 @@ type (
 	// Name type represents the relative path to a template.
 	Name string
 
-	// Title type represents the title of a page.
+	// Title type represents the key of the title of a page in the message
+	// catalogs.
 	Title string
 )
 
-// GetName takes a path to a template file and returns a path relative to the
-// top-level templates directory with the file extension removed.
+// Page is a template rendered within a layout. Each page is parsed into its
+// own copy of its layout and the partials, so the blocks it defines never
+// collide with those of other pages.
+type Page struct {
+	Name   string
+	Layout string
+	tmpl   *template.Template
+}
+
+// Execute renders the page within its layout.
+func (page *Page) Execute(w io.Writer, data Data) error {
+	return page.tmpl.ExecuteTemplate(w, page.Layout, data)
+}
+
+// GetName takes the slash-separated path to a template file relative to the
+// top-level templates directory and returns it with the file extension
+// removed.
 func GetName(path string) string {
-	name := strings.Replace(path, templatePath, "", 1)[1:]
-	return name[:len(name)-5]
+	return strings.TrimSuffix(path, ".html")
+}
+
+// GetLayout returns the name of the layout declared at the start of a page or
+// the default layout if none is declared.
+func GetLayout(contents string) string {
+	if match := layoutDirective.FindStringSubmatch(contents); match != nil {
+		return layoutDirectory + "/" + match[1]
+	}
+
+	return layoutDirectory + "/" + defaultLayout
+}
+
+// ErrParse is returned when a template file cannot be read or parsed.
+type ErrParse struct {
+	Path    string // slash-separated path relative to the top-level templates directory
+	Line    int    // optional line the error was found on
+	Message string
+}
+
+// IsErrParse returns true if the error is an ErrParse.
+func IsErrParse(err error) bool {
+	_, ok := err.(*ErrParse)
+	return ok
+}
+
+// Error implements the error interface for ErrParse.
+func (err *ErrParse) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("template: %s:%d: %s", err.Path, err.Line, err.Message)
+	}
+	return fmt.Sprintf("template: %s: %s", err.Path, err.Message)
+}
+
+// parseErrorLine matches the name and line reported by the template parser,
+// e.g. template: login:12: unexpected "}" in operand.
+var parseErrorLine = regexp.MustCompile(`^template: [^:]+:(\d+): (.*)$`)
+
+// newErrParse returns an ErrParse for an error that occurred while parsing the
+// template file at the path, extracting the line from the error if possible.
+func newErrParse(path string, err error) *ErrParse {
+	if match := parseErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return &ErrParse{Path: path, Line: line, Message: match[2]}
+	}
+
+	return &ErrParse{Path: path, Message: err.Error()}
+}
+
+// Parse reads the template file at the path within the templates and parses
+// it into the set under its name with the template functions available. If
+// the file cannot be read or parsed, an ErrParse is returned.
+func Parse(set *template.Template, assets fs.FS, path string) error {
+	contents, err := fs.ReadFile(assets, path)
+	if err != nil {
+		return &ErrParse{Path: path, Message: err.Error()}
+	}
+
+	if _, err := set.New(GetName(path)).Funcs(funcs).Parse(string(contents)); err != nil {
+		return newErrParse(path, err)
+	}
+
+	return nil
 }
 
-// Assert returns true if the path is a valid template. If an error occurs
-// while opening the path or while fetching its FileInfo, panic is called.
-func Assert(path string) bool {
-	if !shared.GetFileInfo(path).IsDir() && filepath.Ext(path) == ".html" {
-		return true
+// clone returns a copy of the set of templates parsed from the file at the
+// path.
+func clone(set *template.Template, path string) (*template.Template, error) {
+	copied, err := set.Clone()
+	if err != nil {
+		return nil, newErrParse(path, err)
 	}
 
-	return false
+	return copied, nil
 }
 
-// Parse ensures that the file located at the path specified is a valid
-// template before parsing it into the loaded templates. If any errors occur
-// panic is called. If the path is a directory or does not end with .html,
-// nothing happens.
-func Parse(path string) {
-	if Assert(path) && filepath.Ext(path) == ".html" {
-		contents, err := ioutil.ReadFile(path)
+// parseAll parses the partials, layouts and pages within the top-level
+// templates directory and its sub-directories, read from the asset directory
+// if one is set or from the embedded copies otherwise. The pages loaded before
+// are left untouched.
+func parseAll() (map[string]*Page, error) {
+	assets := shared.Assets("templates")
+
+	var partialPaths, layoutPaths, pagePaths []string
+	if err := fs.WalkDir(assets, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+
+		switch strings.SplitN(path, "/", 2)[0] {
+		case partialDirectory:
+			partialPaths = append(partialPaths, path)
+		case layoutDirectory:
+			layoutPaths = append(layoutPaths, path)
+		default:
+			pagePaths = append(pagePaths, path)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("template: got error while walking templates: %s", err)
+	}
+
+	partials := template.New("").Funcs(funcs)
+	for _, path := range partialPaths {
+		if err := Parse(partials, assets, path); err != nil {
+			return nil, err
+		}
+	}
+
+	layouts := make(map[string]*template.Template)
+	for _, path := range layoutPaths {
+		layout, err := clone(partials, path)
 		if err != nil {
-			log.Panicf("template.Parse: got error while reading %s:\n%s", path, err)
+			return nil, err
 		}
+		if err := Parse(layout, assets, path); err != nil {
+			return nil, err
+		}
+		layouts[GetName(path)] = layout
+	}
 
-		name := GetName(path)
-		var tmpl *template.Template
-		if tmpl = templates.Lookup(name); tmpl == nil {
-			tmpl = templates.New(name)
+	parsed := make(map[string]*Page)
+	for _, path := range pagePaths {
+		contents, err := fs.ReadFile(assets, path)
+		if err != nil {
+			return nil, &ErrParse{Path: path, Message: err.Error()}
 		}
 
-		if _, err := tmpl.Parse(string(contents)); err != nil {
-			log.Panic("template.Parse: got error: ", err)
+		page := &Page{Name: GetName(path), Layout: GetLayout(string(contents))}
+		layout, ok := layouts[page.Layout]
+		if !ok {
+			return nil, &ErrParse{Path: path, Line: 1, Message: fmt.Sprintf("unknown layout %s", page.Layout)}
 		}
+
+		if page.tmpl, err = clone(layout, path); err != nil {
+			return nil, err
+		}
+		if err := Parse(page.tmpl, assets, path); err != nil {
+			return nil, err
+		}
+		parsed[page.Name] = page
 	}
+
+	return parsed, nil
 }
 
-// ParseAll recursively parses all templates within the top-level template
-// directory and its sub-directories. If any errors occur panic is called.
+// ParseAll parses every template and replaces the pages loaded before. It is
+// meant to be called once at startup; if any errors occur panic is called.
 func ParseAll() {
-	if err := filepath.Walk(templatePath, func(path string, _ os.FileInfo, err error) error {
-		Parse(path)
-		return nil
-	}); err != nil {
+	parsed, err := parseAll()
+	if err != nil {
 		log.Panic("template.ParseAll: got error:\n", err)
 	}
+
+	pagesMutex.Lock()
+	pages, reloadError = parsed, nil
+	pagesMutex.Unlock()
+}
+
+// getPage returns the page with the name given and the error the last reload
+// failed with, if any.
+func getPage(name string) (*Page, bool, error) {
+	pagesMutex.RLock()
+	defer pagesMutex.RUnlock()
+
+	page, ok := pages[name]
+	return page, ok, reloadError
 }
 
-// Render renders a template given its name and an arbitrary title.
+// Render renders a page within its layout given its name and the catalog key
+// of its title with the status 200 OK. See RenderStatus.
 func Render(w http.ResponseWriter, r *http.Request, tmpl Name, title Title, data Data) {
+	RenderStatus(w, r, http.StatusOK, tmpl, title, data)
+}
+
+// RenderStatus renders a page within its layout given its name and the
+// catalog key of its title with a status code. The title is translated into
+// the locale of the request, which is passed to the template as Locale.
+// Flashes carried by the request are passed to the template as Flashes and,
+// unless the data holds one already, a Form holding the values submitted with
+// the request is passed as Form. The configured branding is passed as Brand
+// and the Content-Security-Policy nonce of the request as Nonce. If a user is
+// logged in, it is passed to the template along with the location, date
+// layout and theme matching their preferences; otherwise the theme follows
+// the preference of the browser. The page is rendered in full before anything
+// is written, so that if it fails only a plain 500 Internal Server Error is
+// sent and the error is logged rather than shown.
+func RenderStatus(w http.ResponseWriter, r *http.Request, status int, tmpl Name, title Title, data Data) {
 	if data == nil {
 		data = Data{}
 	}
 
-	data["Title"] = title
+	locale := i18n.FromContext(r.Context())
+	data["Locale"] = locale
+	data["Title"] = locale.T(string(title))
+	data["Flashes"] = FlashesFromContext(r.Context())
+	if _, ok := data["Form"]; !ok {
+		data["Form"] = NewForm(r)
+	}
+	data["Brand"] = currentBrand()
+	data["Nonce"] = NonceFromContext(r.Context())
+	data["Theme"] = models.DefaultTheme
 
 	if user, ok := models.UserFromContext(r.Context()); ok {
 		data["User"] = user
+		data["Location"] = user.Location()
+		data["DateLayout"] = user.DateLayout()
+		if user.Theme != "" {
+			data["Theme"] = user.Theme
+		}
+	}
+
+	page, ok, err := getPage(string(tmpl))
+	if err != nil && os.Getenv("MODE") == "DEV" {
+		renderOverlay(w, r, err)
+		return
 	}
 
-	if err := templates.ExecuteTemplate(w, string(tmpl), data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var buffer strings.Builder
+	if !ok {
+		err = fmt.Errorf("no page named %s", tmpl)
+	} else {
+		err = page.Execute(&buffer, data)
 	}
+	if err != nil {
+		log.WithFields(log.Fields{"page": tmpl, "error": err.Error()}).Error("template.Render failed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, buffer.String())
 }
 
-// WatchAll watches the templates directory for changes and re-executes
-// templates when they change. If any errors occur panic is called.
-func WatchAll() {
-	watcher, err := fsnotify.NewWatcher()
+// Reload parses the templates again. The new pages replace the current ones
+// only if every template parses; otherwise the current pages continue to be
+// served and the error is returned. In development mode the error is also
+// shown in place of every page until a reload succeeds.
+func Reload() error {
+	parsed, err := parseAll()
+
+	pagesMutex.Lock()
+	defer pagesMutex.Unlock()
+
+	reloadError = err
 	if err != nil {
-		log.Panic("template.WatchAll: got error while creating watcher:\n", err)
+		return err
 	}
-	defer watcher.Close()
+	pages = parsed
+
+	return nil
+}
 
-	if err := filepath.Walk(templatePath, func(path string, file os.FileInfo, err error) error {
+// watchDirectory adds a directory and all of its sub-directories to the
+// watcher.
+func watchDirectory(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if file.IsDir() {
 			return watcher.Add(path)
 		}
 
 		return nil
-	}); err != nil {
+	})
+}
+
+// WatchAll watches the templates directory and its sub-directories, including
+// those created later, for changes and reloads templates once changes have
+// stopped for reloadDelay, until the context is done. Templates can only be
+// watched if an asset directory is set. If the watcher cannot be started
+// panic is called.
+func WatchAll(ctx context.Context) {
+	if shared.AssetDirectory() == "" {
+		log.Warn("template.WatchAll: templates are embedded in the binary, set an asset directory to reload them")
+		return
+	}
+	templatePath := filepath.Join(shared.AssetDirectory(), "templates")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Panic("template.WatchAll: got error while creating watcher:\n", err)
+	}
+	defer watcher.Close()
+
+	if err := watchDirectory(watcher, templatePath); err != nil {
 		log.Panic("template.WatchAll: got error while walking templates directory:\n", err)
 	}
 
-	done := make(chan bool)
+	// The timer is stopped until the first change is seen.
+	timer := time.NewTimer(reloadDelay)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	log.Info("Started template watcher")
+	for {
+		select {
+		case event := <-watcher.Events:
+			if event.Op&fsnotify.Create != 0 {
+				if file, err := os.Stat(event.Name); err == nil && file.IsDir() {
+					if err := watchDirectory(watcher, event.Name); err != nil {
+						log.Warn("template.WatchAll: got error while watching new directory:\n", err)
+					}
+				}
+			}
 
-	go func() {
-		for {
-			select {
-			case _ = <-watcher.Events:
-				log.Info("Templates changed, parsing again")
-				templates = template.New("")
-				ParseAll()
-			case err := <-watcher.Errors:
-				log.Warn("template.WatchAll: got error:", err)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(reloadDelay)
+		case <-timer.C:
+			log.Info("Templates changed, parsing again")
+			if err := Reload(); err != nil {
+				log.Error("template.WatchAll: keeping previous templates after error:\n", err)
 			}
+		case err := <-watcher.Errors:
+			log.Warn("template.WatchAll: got error:", err)
+		case <-ctx.Done():
+			log.Info("Stopped template watcher")
+			return
 		}
-	}()
-
-	log.Info("Started template watcher")
-	<-done
+	}
 }
@@ -0,0 +1,127 @@
+package template
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/octacian/extensus/shared"
+)
+
+// TestMain reads config.json from the root of the source tree rather than the
+// directory of the package.
+func TestMain(m *testing.M) {
+	shared.SetRootDirectory(shared.Abs("."))
+	os.Exit(m.Run())
+}
+
+// TestGetLayout ensures that pages use the layout they declare or the default
+// layout if they declare none.
+func TestGetLayout(t *testing.T) {
+	tests := map[string]string{
+		"{{/* layout: interface */}}\n{{define \"content\"}}{{end}}": "layouts/interface",
+		"\n{{/*layout:admin/wide*/}}":                                "layouts/admin/wide",
+		"{{define \"content\"}}{{end}}":                              "layouts/base",
+		"<p>{{/* layout: interface */}}</p>":                         "layouts/base",
+	}
+
+	for contents, expected := range tests {
+		if got := GetLayout(contents); got != expected {
+			t.Errorf("GetLayout(%q): got '%s' expected '%s'", contents, got, expected)
+		}
+	}
+}
+
+// TestParseAll ensures that every page shipped with the project parses within
+// its layout and that pages are rendered within their layout.
+func TestParseAll(t *testing.T) {
+	NamedRoute("forgot", "/forgot")
+	ParseAll()
+
+	if len(pages) == 0 {
+		t.Fatal("ParseAll: no pages were parsed")
+	}
+	for name, page := range pages {
+		if page.tmpl.Lookup(page.Layout) == nil {
+			t.Errorf("ParseAll: page %s is missing layout %s", name, page.Layout)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	Render(recorder, httptest.NewRequest("GET", "/", nil), "login", "Log In", nil)
+
+	body := recorder.Body.String()
+	if recorder.Code != 200 {
+		t.Fatalf("Render: got status %d with body:\n%s", recorder.Code, body)
+	}
+	for _, expected := range []string{"<title>Log In | Extensus</title>", `<form id="login"`, "</html>"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Render: expected output to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
+
+// writeTemplates writes template files into a temporary asset directory.
+func writeTemplates(t *testing.T, root string, files map[string]string) {
+	for path, contents := range files {
+		path = filepath.Join(root, "templates", filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal("os.MkdirAll: got error:\n", err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal("os.WriteFile: got error:\n", err)
+		}
+	}
+}
+
+// TestReload ensures that the pages loaded before continue to be served when
+// templates fail to parse and that the error is shown in development mode.
+func TestReload(t *testing.T) {
+	root := t.TempDir()
+	shared.SetAssetDirectory(root)
+	defer shared.SetAssetDirectory("")
+	defer os.Unsetenv("MODE")
+
+	writeTemplates(t, root, map[string]string{
+		"layouts/base.html": `<main>{{block "content" .}}{{end}}</main>`,
+		"home.html":         `{{define "content"}}good{{end}}`,
+	})
+	ParseAll()
+
+	writeTemplates(t, root, map[string]string{
+		"home.html": "{{define \"content\"}}\nbad {{missing .Title}}\n{{end}}",
+	})
+	err := Reload()
+	if parseErr, ok := err.(*ErrParse); !ok {
+		t.Fatalf("Reload: expected ErrParse, got: %v", err)
+	} else if parseErr.Path != "home.html" || parseErr.Line != 2 {
+		t.Errorf("Reload: got error at %s:%d expected home.html:2", parseErr.Path, parseErr.Line)
+	}
+
+	render := func() (int, string) {
+		recorder := httptest.NewRecorder()
+		Render(recorder, httptest.NewRequest("GET", "/", nil), "home", "Home", nil)
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, body := render(); code != 200 || body != "<main>good</main>" {
+		t.Errorf("Render: got status %d with body '%s' expected the previous page", code, body)
+	}
+
+	os.Setenv("MODE", "DEV")
+	if code, body := render(); code != 500 || !strings.Contains(body, "home.html:2") {
+		t.Errorf("Render: got status %d with body:\n%s\nexpected the error overlay", code, body)
+	}
+
+	writeTemplates(t, root, map[string]string{
+		"home.html": `{{define "content"}}fixed{{end}}`,
+	})
+	if err := Reload(); err != nil {
+		t.Fatal("Reload: got error:\n", err)
+	}
+	if code, body := render(); code != 200 || body != "<main>fixed</main>" {
+		t.Errorf("Render: got status %d with body '%s' expected the new page", code, body)
+	}
+}
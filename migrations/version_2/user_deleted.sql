@@ -0,0 +1,5 @@
+-- @migrate/up
+ALTER TABLE user ADD COLUMN Deleted TIMESTAMP(3) NULL DEFAULT NULL;
+
+-- @migrate/down
+ALTER TABLE user DROP COLUMN Deleted;
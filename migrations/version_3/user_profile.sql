@@ -0,0 +1,11 @@
+-- @migrate/up
+ALTER TABLE user
+	ADD COLUMN Avatar VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN Timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+	ADD COLUMN DateFormat VARCHAR(16) NOT NULL DEFAULT 'iso';
+
+-- @migrate/down
+ALTER TABLE user
+	DROP COLUMN Avatar,
+	DROP COLUMN Timezone,
+	DROP COLUMN DateFormat;
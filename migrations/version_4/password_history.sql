@@ -0,0 +1,12 @@
+-- @migrate/up
+CREATE TABLE IF NOT EXISTS password_history(
+	ID INT AUTO_INCREMENT PRIMARY KEY,
+	UserID INT NOT NULL,
+	Created TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	Password VARCHAR(255) NOT NULL,
+
+	FOREIGN KEY (UserID) REFERENCES user(ID) ON DELETE CASCADE
+);
+
+-- @migrate/down
+DROP TABLE IF EXISTS password_history;
@@ -0,0 +1,5 @@
+-- @migrate/up
+ALTER TABLE user ADD COLUMN PasswordChanged TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3);
+
+-- @migrate/down
+ALTER TABLE user DROP COLUMN PasswordChanged;
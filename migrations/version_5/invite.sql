@@ -0,0 +1,15 @@
+-- @migrate/up
+CREATE TABLE IF NOT EXISTS invite(
+	ID INT AUTO_INCREMENT PRIMARY KEY,
+	Created TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	Expires TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	Accepted TIMESTAMP(3) NULL DEFAULT NULL,
+
+	Email VARCHAR(255) NOT NULL,
+	InvitedBy INT NULL DEFAULT NULL,
+
+	FOREIGN KEY (InvitedBy) REFERENCES user(ID) ON DELETE SET NULL
+);
+
+-- @migrate/down
+DROP TABLE IF EXISTS invite;
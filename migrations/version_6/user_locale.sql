@@ -0,0 +1,5 @@
+-- @migrate/up
+ALTER TABLE user ADD COLUMN Locale VARCHAR(16) NOT NULL DEFAULT '';
+
+-- @migrate/down
+ALTER TABLE user DROP COLUMN Locale;
@@ -0,0 +1,5 @@
+-- @migrate/up
+ALTER TABLE user ADD COLUMN Theme VARCHAR(16) NOT NULL DEFAULT 'system';
+
+-- @migrate/down
+ALTER TABLE user DROP COLUMN Theme;
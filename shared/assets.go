@@ -0,0 +1,137 @@
+package shared
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/octacian/extensus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// assetDirectory is read instead of the embedded assets if it is set.
+	assetDirectory string
+
+	// extractedAssets maps the name of each top-level asset directory that has
+	// been extracted by AssetPath to the temporary directory holding it.
+	extractedAssets      = make(map[string]string)
+	extractedAssetsMutex sync.Mutex
+)
+
+// SetAssetDirectory makes templates, migrations and static files be read from
+// a directory laid out like the root of the project instead of the copies
+// embedded in the binary. An empty path restores the embedded copies. It is
+// NOT threadsafe and should only be called from main before anything is read.
+func SetAssetDirectory(path string) {
+	if path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	assetDirectory = path
+}
+
+// AssetDirectory returns the directory assets are read from or an empty string
+// if the embedded copies are used.
+func AssetDirectory() string {
+	return assetDirectory
+}
+
+// Assets returns a file system rooted at a top-level asset directory such as
+// templates, read from the asset directory if one is set or from the embedded
+// copies otherwise. If the directory is not embedded panic is called.
+func Assets(name string) fs.FS {
+	if assetDirectory != "" {
+		return os.DirFS(filepath.Join(assetDirectory, name))
+	}
+
+	assets, err := fs.Sub(extensus.Assets, name)
+	if err != nil {
+		log.Panicf("shared.Assets: got error while opening %s: %s", name, err)
+	}
+
+	return assets
+}
+
+// AssetPath returns the path to a directory on disk holding a top-level asset
+// directory, for use with packages that cannot read from an fs.FS. Embedded
+// assets are extracted to a temporary directory the first time they are
+// requested. If any errors occur panic is called.
+func AssetPath(name string) string {
+	if assetDirectory != "" {
+		return filepath.Join(assetDirectory, name)
+	}
+
+	extractedAssetsMutex.Lock()
+	defer extractedAssetsMutex.Unlock()
+
+	if path, ok := extractedAssets[name]; ok {
+		return path
+	}
+
+	path, err := extractAssets(name)
+	if err != nil {
+		log.Panicf("shared.AssetPath: got error while extracting %s: %s", name, err)
+	}
+	extractedAssets[name] = path
+
+	return path
+}
+
+// extractAssets copies an embedded top-level asset directory into a new
+// temporary directory and returns its path.
+func extractAssets(name string) (string, error) {
+	root, err := os.MkdirTemp("", "extensus-"+name+"-")
+	if err != nil {
+		return "", err
+	}
+
+	assets := Assets(name)
+	err = fs.WalkDir(assets, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(path))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		source, err := assets.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, source); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+	if err != nil {
+		os.RemoveAll(root)
+		return "", err
+	}
+
+	return root, nil
+}
+
+// RemoveExtractedAssets removes the temporary directories created by
+// AssetPath. It is NOT threadsafe and should only be called via defer in main.
+func RemoveExtractedAssets() {
+	for name, path := range extractedAssets {
+		if err := os.RemoveAll(path); err != nil {
+			log.Warnf("shared.RemoveExtractedAssets: got error while removing %s: %s", path, err)
+		}
+		delete(extractedAssets, name)
+	}
+}
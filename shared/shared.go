@@ -10,8 +10,46 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// rootDirectory is the directory config.json is read from and that relative
+// paths within it are resolved against. The working directory is used if it
+// is empty.
+var rootDirectory string
+
+// SetRootDirectory changes the directory config.json is read from and that
+// relative paths within it are resolved against. An empty path restores the
+// working directory. It is NOT threadsafe and should only be called from main,
+// or from tests, before anything is read.
+func SetRootDirectory(path string) {
+	if path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	rootDirectory = path
+}
+
+// Path takes a path read from the command line or configuration file and, if
+// it is not already absolute, makes it absolute relative to the root
+// directory.
+func Path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if rootDirectory != "" {
+		return filepath.Join(rootDirectory, path)
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
 // Abs takes a path and, if it is not already absolute, makes it absolute with
-// the assumption that it is relative to the root directory of the project.
+// the assumption that it is relative to the root directory of the source tree
+// the program was built from. It is meant for finding test fixtures; paths
+// used at run time are resolved with Path instead.
 func Abs(path string) string {
 	if filepath.IsAbs(path) {
 		return path
@@ -33,7 +71,7 @@ func Time() time.Time {
 // GetFileInfo returns the file information for a path and panics if any errors
 // occur.
 func GetFileInfo(path string) os.FileInfo {
-	if file, err := os.Open(Abs(path)); err != nil {
+	if file, err := os.Open(Path(path)); err != nil {
 		log.Panicf("GetFileInfo: got error while opening %s: %s", path, err)
 	} else if info, err := file.Stat(); err != nil {
 		log.Panicf("GetFileInfo: got error while fetching file information for %s: %s", path, err)